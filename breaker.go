@@ -0,0 +1,285 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of sending a request while the circuit
+// breaker responsible for the endpoint is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests pass and counts their failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all requests with ErrCircuitOpen until the cooldown expired.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests pass to test the backend.
+	CircuitHalfOpen
+)
+
+// String returns a human readable name for the state.
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerSettings configures a CircuitBreaker.
+//
+// The breaker opens when ConsecutiveFailures requests failed in a row or when the
+// ratio of failed requests within the current Window reaches FailureRate (0.0-1.0)
+// after at least MinRequests requests. A zero ConsecutiveFailures or FailureRate
+// disables the respective threshold. After Cooldown, the breaker becomes half-open
+// and lets Probes requests pass. If all of them succeed, it closes again, a single
+// failure opens it for another Cooldown.
+//
+// IsFailure decides whether a request counts as failed, by default transport errors
+// and responses with a status of 500 and above do. OnStateChange is called after
+// every state transition with the name of the breaker.
+type CircuitBreakerSettings struct {
+	ConsecutiveFailures int
+	FailureRate         float64
+	MinRequests         int
+	Window              time.Duration
+	Cooldown            time.Duration
+	Probes              int
+	IsFailure           func(response *http.Response, err error) bool
+	OnStateChange       func(name string, from CircuitState, to CircuitState)
+}
+
+// CircuitBreaker protects a backend from requests while it is failing.
+// Use NewCircuitBreaker to create one and Connection.SetCircuitBreaker to attach it.
+type CircuitBreaker struct {
+	name     string
+	settings CircuitBreakerSettings
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int
+	successes   int
+	changes     []circuitChange
+}
+
+type circuitChange struct {
+	from CircuitState
+	to   CircuitState
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. Unset settings default to a
+// Window of 60s, MinRequests of 10, a Cooldown of 30s and a single probe request.
+// If neither ConsecutiveFailures nor FailureRate is set, the breaker opens after
+// 5 consecutive failures.
+func NewCircuitBreaker(name string, settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.ConsecutiveFailures <= 0 && settings.FailureRate <= 0 {
+		settings.ConsecutiveFailures = 5
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = 10
+	}
+	if settings.Window <= 0 {
+		settings.Window = time.Second * 60
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = time.Second * 30
+	}
+	if settings.Probes <= 0 {
+		settings.Probes = 1
+	}
+	if settings.IsFailure == nil {
+		settings.IsFailure = defaultIsFailure
+	}
+	return &CircuitBreaker{
+		name:        name,
+		settings:    settings,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+	}
+}
+
+func defaultIsFailure(response *http.Response, err error) bool {
+	return err != nil || response.StatusCode >= 500
+}
+
+// Name returns the name the breaker was created with.
+func (breaker *CircuitBreaker) Name() string {
+	return breaker.name
+}
+
+// State returns the current state of the breaker.
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.mu.Lock()
+	defer breaker.unlock()
+	breaker.advance(time.Now())
+	return breaker.state
+}
+
+// SetCircuitBreaker attaches a circuit breaker to all endpoints starting with
+// prefix. An empty prefix applies the breaker to the whole connection. If several
+// prefixes match an endpoint, the breaker with the longest prefix is used.
+// Passing a nil breaker removes the breaker for the prefix.
+//
+// For requests with WithTemplate or built by NewRequest, prefix is matched
+// against the unexpanded template, e.g. "/{index}/_doc", not against the
+// expanded endpoint.
+func (connection *Connection) SetCircuitBreaker(prefix string, breaker *CircuitBreaker) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if breaker == nil {
+		delete(connection.breakers, prefix)
+		return
+	}
+	if connection.breakers == nil {
+		connection.breakers = make(map[string]*CircuitBreaker)
+	}
+	connection.breakers[prefix] = breaker
+}
+
+// CircuitBreaker returns the circuit breaker responsible for endpoint or nil.
+func (connection *Connection) CircuitBreaker(endpoint string) *CircuitBreaker {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	var found *CircuitBreaker
+	length := -1
+	for prefix, breaker := range connection.breakers {
+		if strings.HasPrefix(endpoint, prefix) && len(prefix) > length {
+			found = breaker
+			length = len(prefix)
+		}
+	}
+	return found
+}
+
+// allow checks whether a request may pass and returns the generation it belongs to.
+func (breaker *CircuitBreaker) allow() (uint64, error) {
+	breaker.mu.Lock()
+	defer breaker.unlock()
+	breaker.advance(time.Now())
+	switch breaker.state {
+	case CircuitOpen:
+		return breaker.generation, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if breaker.probes >= breaker.settings.Probes {
+			return breaker.generation, ErrCircuitOpen
+		}
+		breaker.probes++
+	}
+	return breaker.generation, nil
+}
+
+// record counts the outcome of a request allowed in generation.
+func (breaker *CircuitBreaker) record(generation uint64, response *http.Response, err error) {
+	failed := breaker.settings.IsFailure(response, err)
+
+	breaker.mu.Lock()
+	defer breaker.unlock()
+	now := time.Now()
+	breaker.advance(now)
+	if generation != breaker.generation {
+		// The request was started before the last state change and says nothing
+		// about the current state.
+		return
+	}
+	switch breaker.state {
+	case CircuitClosed:
+		breaker.requests++
+		if failed {
+			breaker.failures++
+			breaker.consecutive++
+			if breaker.tripped() {
+				breaker.setState(CircuitOpen, now)
+			}
+		} else {
+			breaker.consecutive = 0
+		}
+	case CircuitHalfOpen:
+		if failed {
+			breaker.setState(CircuitOpen, now)
+		} else {
+			breaker.successes++
+			if breaker.successes >= breaker.settings.Probes {
+				breaker.setState(CircuitClosed, now)
+			}
+		}
+	}
+}
+
+// unlock releases the lock and reports the state changes which happened while it
+// was held, so OnStateChange may safely call back into the breaker.
+func (breaker *CircuitBreaker) unlock() {
+	changes := breaker.changes
+	breaker.changes = nil
+	breaker.mu.Unlock()
+	if breaker.settings.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		breaker.settings.OnStateChange(breaker.name, change.from, change.to)
+	}
+}
+
+func (breaker *CircuitBreaker) tripped() bool {
+	settings := breaker.settings
+	if settings.ConsecutiveFailures > 0 && breaker.consecutive >= settings.ConsecutiveFailures {
+		return true
+	}
+	if settings.FailureRate > 0 && breaker.requests >= settings.MinRequests {
+		return float64(breaker.failures)/float64(breaker.requests) >= settings.FailureRate
+	}
+	return false
+}
+
+// advance handles the time based transitions: the end of the counting window in
+// the closed state and the end of the cooldown in the open state.
+func (breaker *CircuitBreaker) advance(now time.Time) {
+	switch breaker.state {
+	case CircuitClosed:
+		if now.Sub(breaker.windowStart) >= breaker.settings.Window {
+			breaker.windowStart = now
+			breaker.requests = 0
+			breaker.failures = 0
+		}
+	case CircuitOpen:
+		if now.Sub(breaker.openedAt) >= breaker.settings.Cooldown {
+			breaker.setState(CircuitHalfOpen, now)
+		}
+	}
+}
+
+func (breaker *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	breaker.changes = append(breaker.changes, circuitChange{from: breaker.state, to: state})
+	breaker.state = state
+	breaker.generation++
+	breaker.windowStart = now
+	breaker.requests = 0
+	breaker.failures = 0
+	breaker.consecutive = 0
+	breaker.probes = 0
+	breaker.successes = 0
+	if state == CircuitOpen {
+		breaker.openedAt = now
+	}
+}
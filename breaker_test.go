@@ -0,0 +1,158 @@
+package lra
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(failing *atomic.Bool, hits *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() && r.URL.Path != "/stable" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	var failing atomic.Bool
+	var hits atomic.Int32
+	failing.Store(true)
+	server := newFlakyServer(&failing, &hits)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var changes []string
+	connection := newTestConnection(t, server)
+	connection.SetCircuitBreaker("", NewCircuitBreaker("test", CircuitBreakerSettings{
+		ConsecutiveFailures: 3,
+		Cooldown:            time.Millisecond * 50,
+		Probes:              2,
+		OnStateChange: func(name string, from CircuitState, to CircuitState) {
+			mu.Lock()
+			changes = append(changes, name+":"+from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	}))
+
+	for i := 0; i < 3; i++ {
+		_, err := connection.Get("/api")
+		if err == nil || err.Error() != "502 Bad Gateway" {
+			t.Errorf("Expected error '502 Bad Gateway', got '%v' instead.", err)
+		}
+	}
+	_, err := connection.Get("/api")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got '%v' instead.", err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("Expected 3 requests to reach the server, got %v instead.", hits.Load())
+	}
+
+	failing.Store(false)
+	time.Sleep(time.Millisecond * 60)
+	if state := connection.CircuitBreaker("/api").State(); state != CircuitHalfOpen {
+		t.Errorf("Expected state half-open, got '%v' instead.", state)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := connection.Get("/api"); err != nil {
+			t.Errorf("Expected probe to succeed, got '%v' instead.", err)
+		}
+	}
+	if state := connection.CircuitBreaker("/api").State(); state != CircuitClosed {
+		t.Errorf("Expected state closed, got '%v' instead.", state)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"test:closed->open", "test:open->half-open", "test:half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected state changes %v, got %v instead.", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected state change '%v', got '%v' instead.", expected[i], changes[i])
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpenFailure(t *testing.T) {
+	var failing atomic.Bool
+	var hits atomic.Int32
+	failing.Store(true)
+	server := newFlakyServer(&failing, &hits)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	breaker := NewCircuitBreaker("test", CircuitBreakerSettings{ConsecutiveFailures: 1, Cooldown: time.Millisecond * 20})
+	connection.SetCircuitBreaker("", breaker)
+
+	connection.Get("/api")
+	time.Sleep(time.Millisecond * 30)
+	_, err := connection.Get("/api")
+	if err == nil || err.Error() != "502 Bad Gateway" {
+		t.Errorf("Expected probe error '502 Bad Gateway', got '%v' instead.", err)
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Errorf("Expected state open after failed probe, got '%v' instead.", state)
+	}
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	breaker := NewCircuitBreaker("rate", CircuitBreakerSettings{FailureRate: 0.5, MinRequests: 4})
+	outcomes := []int{200, 500, 200, 200, 500, 500}
+	for i, status := range outcomes {
+		generation, err := breaker.allow()
+		if err != nil {
+			t.Fatalf("Expected request %v to be allowed, got '%v' instead.", i, err)
+		}
+		breaker.record(generation, &http.Response{StatusCode: status}, nil)
+		if i < 5 && breaker.State() != CircuitClosed {
+			t.Errorf("Expected state closed after request %v, got '%v' instead.", i, breaker.State())
+		}
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Errorf("Expected state open, got '%v' instead.", state)
+	}
+}
+
+func TestCircuitBreaker_Prefix(t *testing.T) {
+	var failing atomic.Bool
+	var hits atomic.Int32
+	failing.Store(true)
+	server := newFlakyServer(&failing, &hits)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	global := NewCircuitBreaker("global", CircuitBreakerSettings{ConsecutiveFailures: 10})
+	api := NewCircuitBreaker("api", CircuitBreakerSettings{ConsecutiveFailures: 1})
+	connection.SetCircuitBreaker("", global)
+	connection.SetCircuitBreaker("/api", api)
+
+	if b := connection.CircuitBreaker("/api/x"); b != api {
+		t.Errorf("Expected breaker 'api' for /api/x, got '%v' instead.", b.Name())
+	}
+	if b := connection.CircuitBreaker("/stable"); b != global {
+		t.Errorf("Expected breaker 'global' for /stable, got '%v' instead.", b.Name())
+	}
+
+	connection.Get("/api/x")
+	if _, err := connection.Get("/api/y"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen for /api/y, got '%v' instead.", err)
+	}
+	if _, err := connection.Get("/stable"); err != nil {
+		t.Errorf("Expected /stable to pass, got '%v' instead.", err)
+	}
+
+	connection.SetCircuitBreaker("/api", nil)
+	if b := connection.CircuitBreaker("/api/x"); b != global {
+		t.Errorf("Expected breaker 'global' after removing 'api', got '%v' instead.", b.Name())
+	}
+}
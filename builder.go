@@ -0,0 +1,170 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// RequestBuilder builds a request step by step, e.g.
+//
+//	connection.NewRequest("POST", "/index/{name}/_doc").
+//		PathParam("name", name).
+//		Query("refresh", "true").
+//		JSONBody(doc).
+//		Do(ctx).
+//		DecodeJSON(&result)
+//
+// The request is sent like the other methods of the connection, with its
+// headers, credentials, compression, cache and resilience settings. Errors of the
+// build steps are reported by Build and Do.
+type RequestBuilder struct {
+	connection *Connection
+	method     string
+	path       string
+	params     map[string]interface{}
+	header     http.Header
+	options    []RequestOption
+	body       io.Reader
+	length     int64
+	err        error
+}
+
+// NewRequest starts building a request with method to path. Path is a RFC 6570
+// URI template, whose variables are set with PathParam and Param. Like with
+// WithTemplate, rate limiters, bulkheads and circuit breakers see the unexpanded
+// path, so all requests to a template share them.
+func (connection *Connection) NewRequest(method string, path string) *RequestBuilder {
+	return &RequestBuilder{
+		connection: connection,
+		method:     method,
+		path:       path,
+		params:     make(map[string]interface{}),
+		header:     make(http.Header),
+	}
+}
+
+// PathParam sets the path parameter {name} to value. The value is escaped as a
+// single path segment, so slashes and spaces can not change the addressed
+// resource.
+func (builder *RequestBuilder) PathParam(name string, value string) *RequestBuilder {
+	return builder.Param(name, value)
+}
+
+// Param sets the template variable name to value, which may also be a []string
+// or map[string]string, see ExpandTemplate.
+func (builder *RequestBuilder) Param(name string, value interface{}) *RequestBuilder {
+	builder.params[name] = value
+	return builder
+}
+
+// Query adds the query parameter name with value.
+func (builder *RequestBuilder) Query(name string, value string) *RequestBuilder {
+	return builder.Option(WithQuery(name, value))
+}
+
+// Header sets the header name to value.
+func (builder *RequestBuilder) Header(name string, value string) *RequestBuilder {
+	return builder.Option(WithHeader(name, value))
+}
+
+// Option adds request options.
+func (builder *RequestBuilder) Option(options ...RequestOption) *RequestBuilder {
+	builder.options = append(builder.options, options...)
+	return builder
+}
+
+// Body sets the body read from body. Length is the size of the body or -1 if it
+// is unknown, see PostReader.
+func (builder *RequestBuilder) Body(body io.Reader, length int64) *RequestBuilder {
+	builder.body = body
+	builder.length = length
+	return builder
+}
+
+// JSONBody sets v encoded as JSON as body. Content-Type defaults to
+// application/json unless it is set in the SendHeaders of the connection.
+func (builder *RequestBuilder) JSONBody(v interface{}) *RequestBuilder {
+	b, err := json.Marshal(v)
+	if err != nil {
+		builder.err = err
+		return builder
+	}
+	builder.header = builder.connection.defaultHeader(builder.header, "Content-Type", "application/json")
+	return builder.Body(bytes.NewReader(b), int64(len(b)))
+}
+
+// Build returns the request as it would be sent by Do, for inspection or to send
+// it with another client. The body of the request can be read only once.
+func (builder *RequestBuilder) Build(ctx context.Context) (*http.Request, error) {
+	req, _, _, err := builder.build(ctx)
+	return req, err
+}
+
+func (builder *RequestBuilder) build(ctx context.Context) (*http.Request, string, *requestOptions, error) {
+	if builder.err != nil {
+		return nil, "", nil, builder.err
+	}
+	options := append([]RequestOption{WithTemplate(builder.params)}, builder.options...)
+	o := newRequestOptions(options)
+	req, err := builder.connection.newRequest(ctx, builder.method, builder.path, builder.body, builder.length, builder.header, o)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return req, builder.path, o, nil
+}
+
+// Do sends the request and reads the response.
+func (builder *RequestBuilder) Do(ctx context.Context) *Result {
+	req, endpoint, o, err := builder.build(ctx)
+	if err != nil {
+		return &Result{err: err}
+	}
+	response, r, err := builder.connection.readResponse(o.client(builder.connection.httpClient()), req, endpoint)
+	result := &Result{Body: response, err: err, connection: builder.connection, method: builder.method}
+	if r != nil {
+		result.StatusCode = r.StatusCode
+		result.Header = r.Header
+	}
+	return result
+}
+
+// Result is the read response of a request sent by a RequestBuilder.
+type Result struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	err        error
+	connection *Connection
+	method     string
+}
+
+// Err returns the error of the request, a *StatusError for status codes above 399.
+func (result *Result) Err() error {
+	return result.err
+}
+
+// DecodeJSON parses the response as JSON into v and returns the error of the
+// request or the parse error, like the *JSON methods.
+func (result *Result) DecodeJSON(v interface{}) error {
+	if result.Header == nil {
+		return result.err
+	}
+	return result.connection.decodeJSON(result.method, result.Body, result.Header, result.err, v)
+}
+
+// Decode parses the response into v with the codec for its Content-Type or the
+// default codec, see Send.
+func (result *Result) Decode(v interface{}) error {
+	if result.Header == nil {
+		return result.err
+	}
+	return result.connection.decodeResponse(result.connection.DefaultCodec(), result.Body, result.Header, result.err, v)
+}
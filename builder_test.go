@@ -0,0 +1,118 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newBuilderServer echoes the escaped path, query, content type and body.
+func newBuilderServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"stringdata":"not found"}`))
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"method":"` + r.Method + `","path":"` + r.URL.EscapedPath() + `","protocol":"` + r.URL.RawQuery + `","stringdata":"` + r.Header.Get("Content-Type") + `","intdata":` + strconv.Itoa(len(b)) + `}`))
+	}))
+}
+
+func TestRequestBuilder(t *testing.T) {
+	server := newBuilderServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var data ReturnData
+	err := connection.NewRequest("POST", "/index/{name}/_doc/{id}").
+		PathParam("name", "logs").
+		PathParam("id", "a/b c").
+		Query("refresh", "true").
+		Header("X-Extra", "extra").
+		JSONBody(map[string]int{"a": 1}).
+		Do(context.Background()).
+		DecodeJSON(&data)
+	if err != nil {
+		t.Fatalf("Error sending request: %v", err.Error())
+	}
+	if data.Method != "POST" || data.Path != "/index/logs/_doc/a%2Fb%20c" || data.Protocol != "refresh=true" {
+		t.Errorf("Expected POST to /index/logs/_doc/a%%2Fb%%20c?refresh=true, got %v to %v?%v instead.", data.Method, data.Path, data.Protocol)
+	}
+	if data.StringData != "application/json" || data.IntData != 7 {
+		t.Errorf("Expected a JSON body of 7 bytes, got '%v' and %v instead.", data.StringData, data.IntData)
+	}
+}
+
+func TestRequestBuilder_Build(t *testing.T) {
+	server := newBuilderServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	req, err := connection.NewRequest("GET", "/items/{id}").PathParam("id", "1").Query("q", "x").Build(context.Background())
+	if err != nil {
+		t.Fatalf("Error building request: %v", err.Error())
+	}
+	if req.URL.String() != server.URL+"/items/1?q=x" || req.Header.Get("Test-Header") != "test" {
+		t.Errorf("Expected %v/items/1?q=x with the SendHeaders, got %v and %v instead.", server.URL, req.URL, req.Header)
+	}
+
+	req, err = connection.NewRequest("GET", "/items{?tags*}").Param("tags", []string{"a b", "c"}).Build(context.Background())
+	if err != nil || req.URL.RawQuery != "tags=a%20b&tags=c" {
+		t.Errorf("Expected query 'tags=a%%20b&tags=c', got '%v' and '%v' instead.", req.URL.RawQuery, err)
+	}
+
+	_, err = connection.NewRequest("GET", "/items/{id}").Build(context.Background())
+	if err == nil {
+		t.Errorf("Expected an error for a missing path parameter, got nil")
+	}
+	result := connection.NewRequest("GET", "/items/{id").Do(context.Background())
+	if result.Err() == nil || result.DecodeJSON(new(ReturnData)) == nil {
+		t.Errorf("Expected an error for an unterminated path parameter, got nil")
+	}
+}
+
+func TestRequestBuilder_StatusError(t *testing.T) {
+	server := newBuilderServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	result := connection.NewRequest("GET", "/missing").Do(context.Background())
+	var statusError *StatusError
+	if !errors.As(result.Err(), &statusError) || result.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 StatusError, got %v and '%v' instead.", result.StatusCode, result.Err())
+	}
+	var data ReturnData
+	if err := result.Decode(&data); err != result.Err() || data.StringData != "not found" {
+		t.Errorf("Expected the error body to be decoded, got '%v' and '%v' instead.", data.StringData, err)
+	}
+}
+
+func TestRequestBuilder_TemplateBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	breaker := NewCircuitBreaker("items", CircuitBreakerSettings{ConsecutiveFailures: 1})
+	connection.SetCircuitBreaker("/items/{id}", breaker)
+	result := connection.NewRequest("GET", "/items/{id}").PathParam("id", "1").Do(context.Background())
+	var statusError *StatusError
+	if !errors.As(result.Err(), &statusError) {
+		t.Fatalf("Expected a StatusError, got '%v' instead.", result.Err())
+	}
+	result = connection.NewRequest("GET", "/items/{id}").PathParam("id", "2").Do(context.Background())
+	if !errors.Is(result.Err(), ErrCircuitOpen) {
+		t.Errorf("Expected the breaker of the template to be open, got '%v' instead.", result.Err())
+	}
+	_, err := connection.Get("/items/{id}", WithTemplate(map[string]interface{}{"id": "3"}))
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the breaker of the template to be open, got '%v' instead.", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull is returned when a request could not get a slot within the
+// queue timeout of the Bulkhead.
+var ErrBulkheadFull = errors.New("too many requests in flight")
+
+// Priority decides the order in which queued requests get a slot in the Bulkhead.
+type Priority int
+
+const (
+	// PriorityLow requests are served after all other queued requests.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of requests without a matching priority rule.
+	PriorityNormal Priority = 0
+	// PriorityHigh requests are served before all other queued requests.
+	PriorityHigh Priority = 1
+)
+
+// BulkheadStats are the metrics of a single priority lane of a Bulkhead.
+type BulkheadStats struct {
+	InFlight  int
+	Queued    int
+	Acquired  uint64
+	Rejected  uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AverageWait returns the average time requests waited in the queue.
+func (stats BulkheadStats) AverageWait() time.Duration {
+	if stats.Acquired == 0 {
+		return 0
+	}
+	return stats.TotalWait / time.Duration(stats.Acquired)
+}
+
+// Bulkhead limits the number of requests in flight. Requests exceeding the limit
+// are queued by priority until a slot is free or the queue timeout expired.
+// Use NewBulkhead to create one and Connection.SetBulkhead to attach it.
+type Bulkhead struct {
+	max          int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	lanes    map[Priority]*bulkheadLane
+	waiters  []*bulkheadWaiter
+}
+
+type bulkheadLane struct {
+	limit int
+	stats BulkheadStats
+}
+
+type bulkheadWaiter struct {
+	priority Priority
+	ready    chan struct{}
+	granted  bool
+}
+
+// NewBulkhead creates a bulkhead allowing maxInFlight concurrent requests. Queued
+// requests fail with ErrBulkheadFull after queueTimeout, a zero queueTimeout lets
+// them wait until their context is done.
+func NewBulkhead(maxInFlight int, queueTimeout time.Duration) *Bulkhead {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &Bulkhead{
+		max:          maxInFlight,
+		queueTimeout: queueTimeout,
+		lanes:        make(map[Priority]*bulkheadLane),
+	}
+}
+
+// SetLaneLimit limits the number of requests in flight with the given priority,
+// e.g. to keep some capacity free for high priority requests. A limit of 0
+// removes the lane limit.
+func (bulkhead *Bulkhead) SetLaneLimit(priority Priority, limit int) {
+	bulkhead.mu.Lock()
+	defer bulkhead.mu.Unlock()
+	bulkhead.lane(priority).limit = limit
+	bulkhead.grant()
+}
+
+// Stats returns a snapshot of the metrics of all lanes which have been used.
+func (bulkhead *Bulkhead) Stats() map[Priority]BulkheadStats {
+	bulkhead.mu.Lock()
+	defer bulkhead.mu.Unlock()
+	stats := make(map[Priority]BulkheadStats, len(bulkhead.lanes))
+	for priority, lane := range bulkhead.lanes {
+		stats[priority] = lane.stats
+	}
+	return stats
+}
+
+// Acquire waits for a slot for a request with the given priority. The returned
+// function must be called to give the slot back once the request is finished.
+func (bulkhead *Bulkhead) Acquire(ctx context.Context, priority Priority) (func(), error) {
+	start := time.Now()
+	bulkhead.mu.Lock()
+	lane := bulkhead.lane(priority)
+	if len(bulkhead.waiters) == 0 && bulkhead.available(lane) {
+		bulkhead.take(lane)
+		bulkhead.mu.Unlock()
+		return bulkhead.releaser(priority), nil
+	}
+	waiter := &bulkheadWaiter{priority: priority, ready: make(chan struct{})}
+	bulkhead.enqueue(waiter)
+	lane.stats.Queued++
+	bulkhead.grant()
+	bulkhead.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if bulkhead.queueTimeout > 0 {
+		timer := time.NewTimer(bulkhead.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-waiter.ready:
+	case <-timeout:
+		err = ErrBulkheadFull
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	bulkhead.mu.Lock()
+	defer bulkhead.mu.Unlock()
+	if waiter.granted {
+		// The slot may have been granted while the timeout fired, use it anyway.
+		wait := time.Since(start)
+		lane.stats.TotalWait += wait
+		if wait > lane.stats.MaxWait {
+			lane.stats.MaxWait = wait
+		}
+		return bulkhead.releaser(priority), nil
+	}
+	bulkhead.dequeue(waiter)
+	lane.stats.Queued--
+	lane.stats.Rejected++
+	return nil, err
+}
+
+func (bulkhead *Bulkhead) lane(priority Priority) *bulkheadLane {
+	lane, ok := bulkhead.lanes[priority]
+	if !ok {
+		lane = new(bulkheadLane)
+		bulkhead.lanes[priority] = lane
+	}
+	return lane
+}
+
+func (bulkhead *Bulkhead) available(lane *bulkheadLane) bool {
+	return bulkhead.inFlight < bulkhead.max && (lane.limit <= 0 || lane.stats.InFlight < lane.limit)
+}
+
+func (bulkhead *Bulkhead) take(lane *bulkheadLane) {
+	bulkhead.inFlight++
+	lane.stats.InFlight++
+	lane.stats.Acquired++
+}
+
+// enqueue inserts the waiter behind all waiters with the same or a higher priority.
+func (bulkhead *Bulkhead) enqueue(waiter *bulkheadWaiter) {
+	i := len(bulkhead.waiters)
+	for i > 0 && bulkhead.waiters[i-1].priority < waiter.priority {
+		i--
+	}
+	bulkhead.waiters = append(bulkhead.waiters, nil)
+	copy(bulkhead.waiters[i+1:], bulkhead.waiters[i:])
+	bulkhead.waiters[i] = waiter
+}
+
+func (bulkhead *Bulkhead) dequeue(waiter *bulkheadWaiter) {
+	for i, w := range bulkhead.waiters {
+		if w == waiter {
+			bulkhead.waiters = append(bulkhead.waiters[:i], bulkhead.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// grant hands free slots to the queued waiters in priority order. Waiters whose
+// lane is full are skipped so they do not block other lanes.
+func (bulkhead *Bulkhead) grant() {
+	for i := 0; i < len(bulkhead.waiters) && bulkhead.inFlight < bulkhead.max; {
+		waiter := bulkhead.waiters[i]
+		lane := bulkhead.lane(waiter.priority)
+		if !bulkhead.available(lane) {
+			i++
+			continue
+		}
+		bulkhead.waiters = append(bulkhead.waiters[:i], bulkhead.waiters[i+1:]...)
+		bulkhead.take(lane)
+		lane.stats.Queued--
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+func (bulkhead *Bulkhead) releaser(priority Priority) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bulkhead.mu.Lock()
+			defer bulkhead.mu.Unlock()
+			bulkhead.inFlight--
+			bulkhead.lane(priority).stats.InFlight--
+			bulkhead.grant()
+		})
+	}
+}
+
+// releaseBody gives the bulkhead slot back when the response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *releaseBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.release()
+	return err
+}
+
+type priorityRule struct {
+	method   string
+	pattern  string
+	priority Priority
+}
+
+// SetBulkhead limits the number of concurrent requests of the connection. Passing
+// nil removes the limit.
+func (connection *Connection) SetBulkhead(bulkhead *Bulkhead) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	connection.bulkhead = bulkhead
+}
+
+// Bulkhead returns the bulkhead of the connection or nil.
+func (connection *Connection) Bulkhead() *Bulkhead {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	return connection.bulkhead
+}
+
+// SetPriority sets the priority of requests with the given method whose endpoint
+// path matches pattern, using the same matching rules as SetRateLimiter. The first
+// matching rule wins, requests without a matching rule have PriorityNormal.
+// Like for SetRateLimiter, templated requests are matched by their unexpanded
+// template.
+func (connection *Connection) SetPriority(method string, pattern string, priority Priority) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	for i, rule := range connection.priorities {
+		if rule.method == method && rule.pattern == pattern {
+			connection.priorities[i].priority = priority
+			return
+		}
+	}
+	connection.priorities = append(connection.priorities, priorityRule{method: method, pattern: pattern, priority: priority})
+}
+
+// Priority returns the priority of a request with method to endpoint.
+func (connection *Connection) Priority(method string, endpoint string) Priority {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	for _, rule := range connection.priorities {
+		if matchEndpoint(rule.method, rule.pattern, method, endpoint) {
+			return rule.priority
+		}
+	}
+	return PriorityNormal
+}
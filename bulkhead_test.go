@@ -0,0 +1,141 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkhead_MaxInFlight(t *testing.T) {
+	var current, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		current.Add(-1)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	bulkhead := NewBulkhead(2, 0)
+	connection.SetBulkhead(bulkhead)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := connection.Get("/api"); err != nil {
+				t.Errorf("Error in request: %v", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %v instead.", peak.Load())
+	}
+	stats := bulkhead.Stats()[PriorityNormal]
+	if stats.Acquired != 6 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Expected 6 acquired, 0 in flight and 0 queued, got %+v instead.", stats)
+	}
+	if stats.MaxWait <= 0 {
+		t.Errorf("Expected queued requests to have waited, got max wait %v instead.", stats.MaxWait)
+	}
+}
+
+func TestBulkhead_QueueTimeout(t *testing.T) {
+	bulkhead := NewBulkhead(1, time.Millisecond*20)
+	release, err := bulkhead.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Expected first slot, got '%v' instead.", err)
+	}
+	if _, err := bulkhead.Acquire(context.Background(), PriorityNormal); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected ErrBulkheadFull, got '%v' instead.", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bulkhead.Acquire(ctx, PriorityNormal); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got '%v' instead.", err)
+	}
+	release()
+	release()
+	stats := bulkhead.Stats()[PriorityNormal]
+	if stats.Rejected != 2 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Expected 2 rejected, 0 in flight and 0 queued, got %+v instead.", stats)
+	}
+}
+
+func TestBulkhead_Priority(t *testing.T) {
+	bulkhead := NewBulkhead(1, 0)
+	release, _ := bulkhead.Acquire(context.Background(), PriorityNormal)
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	for _, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		wg.Add(1)
+		go func(priority Priority) {
+			defer wg.Done()
+			r, err := bulkhead.Acquire(context.Background(), priority)
+			if err != nil {
+				t.Errorf("Error acquiring slot: %v", err.Error())
+				return
+			}
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+			r()
+		}(priority)
+		// Make sure the waiters are queued one after the other.
+		for bulkhead.Stats()[priority].Queued != 1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+	wg.Wait()
+	if len(order) != 3 || order[0] != PriorityHigh || order[1] != PriorityNormal || order[2] != PriorityLow {
+		t.Errorf("Expected order [high normal low], got %v instead.", order)
+	}
+}
+
+func TestBulkhead_LaneLimit(t *testing.T) {
+	bulkhead := NewBulkhead(3, time.Millisecond*20)
+	bulkhead.SetLaneLimit(PriorityLow, 1)
+	if _, err := bulkhead.Acquire(context.Background(), PriorityLow); err != nil {
+		t.Fatalf("Expected low priority slot, got '%v' instead.", err)
+	}
+	if _, err := bulkhead.Acquire(context.Background(), PriorityLow); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected ErrBulkheadFull for second low priority request, got '%v' instead.", err)
+	}
+	if _, err := bulkhead.Acquire(context.Background(), PriorityHigh); err != nil {
+		t.Errorf("Expected high priority slot, got '%v' instead.", err)
+	}
+}
+
+func TestConnection_Priority(t *testing.T) {
+	connection, err := NewConnection(false, "localhost", 80, "", "", "", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	connection.SetPriority("GET", "/_cluster/*", PriorityHigh)
+	connection.SetPriority("", "/_bulk", PriorityLow)
+	if p := connection.Priority("GET", "/_cluster/health"); p != PriorityHigh {
+		t.Errorf("Expected high priority, got %v instead.", p)
+	}
+	if p := connection.Priority("POST", "/_bulk?refresh=true"); p != PriorityLow {
+		t.Errorf("Expected low priority, got %v instead.", p)
+	}
+	if p := connection.Priority("POST", "/_cluster/health"); p != PriorityNormal {
+		t.Errorf("Expected normal priority, got %v instead.", p)
+	}
+}
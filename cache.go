@@ -0,0 +1,435 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStats counts how requests were answered by a HTTPCache. Hits were served
+// from the cache without contacting the server, Revalidations were served from
+// the cache after the server answered 304 Not Modified and Misses were answered
+// by the server. Stores counts the responses written to the cache.
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Revalidations int64
+	Stores        int64
+}
+
+// HTTPCache is a private HTTP cache (RFC 9111) for GET and HEAD requests.
+//
+// Responses are stored if Cache-Control and Expires allow it and they either have
+// an explicit freshness lifetime or validators. Fresh responses are served from
+// the cache, stale ones are revalidated with If-None-Match and If-Modified-Since
+// and served from the cache if the server answers 304 Not Modified. The request
+// directives no-cache, no-store, max-age, min-fresh, max-stale and only-if-cached
+// are honored, Vary selects between requests. Successful unsafe requests remove
+// the entries of their URL. A response is stored when its body was read
+// completely, so streamed responses are returned as soon as their headers
+// arrived. Responses larger than MaxEntrySize or closed before the end of the
+// body are not stored.
+//
+// Requests with Range or conditional headers bypass the cache.
+type HTTPCache struct {
+	MaxEntrySize int64
+
+	store CacheStore
+	mu    sync.Mutex
+	stats CacheStats
+}
+
+// NewHTTPCache creates a HTTPCache storing entries in store, with a MaxEntrySize
+// of 10 MiB.
+func NewHTTPCache(store CacheStore) *HTTPCache {
+	return &HTTPCache{
+		MaxEntrySize: 10 << 20,
+		store:        store,
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (cache *HTTPCache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.stats
+}
+
+// SetCache sets the HTTP cache used for the requests of the connection, nil
+// disables caching. A cache may be shared by several connections.
+func (connection *Connection) SetCache(cache *HTTPCache) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	connection.cache = cache
+}
+
+// Cache returns the HTTP cache of the connection or nil.
+func (connection *Connection) Cache() *HTTPCache {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	return connection.cache
+}
+
+// cacheMeta is stored in front of the response in a cache entry.
+type cacheMeta struct {
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+	Vary         http.Header `json:"vary,omitempty"`
+}
+
+// cacheControl are the directives of a Cache-Control header.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(argument, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the duration given as argument of the directive name.
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	s, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || s < 0 {
+		return 0, false
+	}
+	return time.Duration(s) * time.Second, true
+}
+
+// heuristicStatus are the status codes which are cacheable by default.
+var heuristicStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+func cacheKey(method string, u *url.URL) string {
+	return method + " " + u.String()
+}
+
+// do answers req from the cache or with send, which sends req to the server.
+func (cache *HTTPCache) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		r, err := send(req)
+		if err == nil && r.StatusCode < 400 {
+			cache.store.Delete(cacheKey("GET", req.URL))
+			cache.store.Delete(cacheKey("HEAD", req.URL))
+		}
+		return r, err
+	}
+	for _, h := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if req.Header.Get(h) != "" {
+			return send(req)
+		}
+	}
+
+	key := cacheKey(req.Method, req.URL)
+	requestCC := parseCacheControl(req.Header)
+	if len(requestCC) == 0 && req.Header.Get("Pragma") == "no-cache" {
+		requestCC["no-cache"] = ""
+	}
+	meta, cached := cache.load(key, req)
+	if cached != nil && usable(meta, cached, requestCC, time.Now()) {
+		cache.count(func(stats *CacheStats) { stats.Hits++ })
+		return cached, nil
+	}
+	if requestCC.has("only-if-cached") {
+		return &http.Response{
+			Status:     "504 Gateway Timeout",
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	outgoing := req
+	if cached != nil {
+		etag := cached.Header.Get("ETag")
+		lastModified := cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outgoing = req.Clone(req.Context())
+			if etag != "" {
+				outgoing.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outgoing.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	requestTime := time.Now()
+	r, err := send(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := time.Now()
+	if r.StatusCode == http.StatusNotModified && outgoing != req {
+		r.Body.Close()
+		cached.Header.Del("Age")
+		for h, v := range r.Header {
+			switch h {
+			case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			default:
+				cached.Header[h] = v
+			}
+		}
+		meta.RequestTime = requestTime
+		meta.ResponseTime = responseTime
+		b, err := io.ReadAll(cached.Body)
+		if err != nil {
+			return nil, err
+		}
+		cache.save(key, meta, cached, b)
+		cached.Body = io.NopCloser(bytes.NewReader(b))
+		cache.count(func(stats *CacheStats) { stats.Revalidations++ })
+		return cached, nil
+	}
+
+	cache.count(func(stats *CacheStats) { stats.Misses++ })
+	if !storable(r, requestCC) {
+		return r, nil
+	}
+	meta = &cacheMeta{RequestTime: requestTime, ResponseTime: responseTime, Vary: varyHeader(r, req)}
+	if req.Method == "HEAD" {
+		cache.save(key, meta, r, nil)
+		return r, nil
+	}
+	// The body is stored when the caller read it completely, so streamed
+	// responses are returned as soon as the headers arrived. The headers are
+	// copied now, as decompressResponse removes Content-Encoding from r while
+	// the stored body stays encoded.
+	stored := &http.Response{Status: r.Status, StatusCode: r.StatusCode, Header: r.Header.Clone()}
+	r.Body = &cachingBody{ReadCloser: r.Body, max: cache.MaxEntrySize, save: func(b []byte) {
+		cache.save(key, meta, stored, b)
+	}}
+	return r, nil
+}
+
+func (cache *HTTPCache) count(f func(stats *CacheStats)) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	f(&cache.stats)
+}
+
+// load returns the entry stored for key if it matches the Vary headers of req.
+func (cache *HTTPCache) load(key string, req *http.Request) (*cacheMeta, *http.Response) {
+	b, ok := cache.store.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	line, rest, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return nil, nil
+	}
+	meta := new(cacheMeta)
+	if err := json.Unmarshal(line, meta); err != nil {
+		return nil, nil
+	}
+	for h, values := range meta.Vary {
+		if strings.Join(req.Header.Values(h), ",") != strings.Join(values, ",") {
+			return nil, nil
+		}
+	}
+	r, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rest)), req)
+	if err != nil {
+		return nil, nil
+	}
+	return meta, r
+}
+
+// save stores r with the body b for key.
+func (cache *HTTPCache) save(key string, meta *cacheMeta, r *http.Response, b []byte) {
+	line, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	stored := &http.Response{
+		Status:        r.Status,
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+	}
+	var buf bytes.Buffer
+	buf.Write(line)
+	buf.WriteByte('\n')
+	if err := stored.Write(&buf); err != nil {
+		return
+	}
+	cache.store.Set(key, buf.Bytes())
+	cache.count(func(stats *CacheStats) { stats.Stores++ })
+}
+
+// varyHeader returns the request headers selected by the Vary header of r.
+func varyHeader(r *http.Response, req *http.Request) http.Header {
+	var vary http.Header
+	for _, value := range r.Header.Values("Vary") {
+		for _, h := range strings.Split(value, ",") {
+			h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+			if h == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[h] = req.Header.Values(h)
+		}
+	}
+	return vary
+}
+
+// storable reports if r may be stored.
+func storable(r *http.Response, requestCC cacheControl) bool {
+	responseCC := parseCacheControl(r.Header)
+	if requestCC.has("no-store") || responseCC.has("no-store") {
+		return false
+	}
+	if r.StatusCode == http.StatusPartialContent || r.StatusCode == http.StatusNotModified {
+		return false
+	}
+	for _, value := range r.Header.Values("Vary") {
+		if strings.Contains(value, "*") {
+			return false
+		}
+	}
+	if responseCC.has("max-age") || responseCC.has("public") || r.Header.Get("Expires") != "" {
+		return true
+	}
+	return heuristicStatus[r.StatusCode] && (r.Header.Get("ETag") != "" || r.Header.Get("Last-Modified") != "")
+}
+
+// usable reports if the cached response r can be served for a request with the
+// directives requestCC at now, without validating it. The Age header of r is set.
+func usable(meta *cacheMeta, r *http.Response, requestCC cacheControl, now time.Time) bool {
+	responseCC := parseCacheControl(r.Header)
+	if requestCC.has("no-cache") || responseCC.has("no-cache") {
+		return false
+	}
+	lifetime := freshnessLifetime(meta, r, responseCC)
+	age := currentAge(meta, r, now)
+	if maxAge, ok := requestCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := requestCC.seconds("min-fresh"); ok && lifetime-age < minFresh {
+		return false
+	}
+	if age >= lifetime {
+		if !requestCC.has("max-stale") || responseCC.has("must-revalidate") {
+			return false
+		}
+		if maxStale, ok := requestCC.seconds("max-stale"); ok && age-lifetime > maxStale {
+			return false
+		}
+	}
+	r.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return true
+}
+
+// freshnessLifetime returns how long r is fresh after it was created.
+func freshnessLifetime(meta *cacheMeta, r *http.Response, responseCC cacheControl) time.Duration {
+	if maxAge, ok := responseCC.seconds("max-age"); ok {
+		return maxAge
+	}
+	date := responseDate(meta, r)
+	if expires := r.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires means already expired.
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(r.Header.Get("Last-Modified")); err == nil && heuristicStatus[r.StatusCode] && date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// currentAge returns the age of r at now (RFC 9111 4.2.3).
+func currentAge(meta *cacheMeta, r *http.Response, now time.Time) time.Duration {
+	apparentAge := meta.ResponseTime.Sub(responseDate(meta, r))
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	var ageValue time.Duration
+	if s, err := strconv.ParseInt(r.Header.Get("Age"), 10, 64); err == nil && s > 0 {
+		ageValue = time.Duration(s) * time.Second
+	}
+	correctedAge := ageValue + meta.ResponseTime.Sub(meta.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(meta.ResponseTime)
+}
+
+func responseDate(meta *cacheMeta, r *http.Response) time.Time {
+	if date, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+		return date
+	}
+	return meta.ResponseTime
+}
+
+// cachingBody is a response body which keeps a copy of the data read and passes it
+// to save when the body was read completely. Bodies larger than max are not kept.
+type cachingBody struct {
+	io.ReadCloser
+	max  int64
+	buf  bytes.Buffer
+	skip bool
+	save func(b []byte)
+}
+
+func (body *cachingBody) Read(b []byte) (int, error) {
+	n, err := body.ReadCloser.Read(b)
+	if !body.skip {
+		body.buf.Write(b[:n])
+		if int64(body.buf.Len()) > body.max {
+			body.skip = true
+			body.buf = bytes.Buffer{}
+		}
+		if err == io.EOF {
+			body.skip = true
+			body.save(body.buf.Bytes())
+			body.buf = bytes.Buffer{}
+		}
+	}
+	return n, err
+}
+
+// Close closes the body. A body which was not read completely is not stored.
+func (body *cachingBody) Close() error {
+	body.skip = true
+	body.buf = bytes.Buffer{}
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,262 @@
+package lra
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// newCacheServer counts the requests per path and answers with cache headers
+// depending on the path.
+func newCacheServer() (*httptest.Server, func(path string) int) {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/stale":
+			w.Header().Set("Cache-Control", "max-age=5")
+			w.Header().Set("Age", "10")
+			w.Header().Set("ETag", `"v1"`)
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"method":"` + r.Method + `","stringdata":"` + r.URL.Path + `"}`))
+	}))
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return counts[path]
+	}
+}
+
+func TestHTTPCache_Fresh(t *testing.T) {
+	server, count := newCacheServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	cache := NewHTTPCache(NewMemoryCache(1 << 20))
+	connection.SetCache(cache)
+	for i := 0; i < 3; i++ {
+		var data ReturnData
+		if err := connection.GetJSON("/fresh", &data); err != nil {
+			t.Fatalf("Error getting JSON: %v", err.Error())
+		}
+		if data.StringData != "/fresh" {
+			t.Errorf("Expected '/fresh', got '%v' instead.", data.StringData)
+		}
+	}
+	if count("/fresh") != 1 {
+		t.Errorf("Expected 1 request to the server, got %v instead.", count("/fresh"))
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Stores != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 store, got %+v instead.", stats)
+	}
+
+	// A successful unsafe request invalidates the entry.
+	if _, err := connection.Post("/fresh", indata); err != nil {
+		t.Fatalf("Error posting: %v", err.Error())
+	}
+	connection.Get("/fresh")
+	if count("/fresh") != 3 {
+		t.Errorf("Expected 3 requests to the server, got %v instead.", count("/fresh"))
+	}
+}
+
+func TestHTTPCache_Revalidate(t *testing.T) {
+	server, count := newCacheServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	cache := NewHTTPCache(NewMemoryCache(1 << 20))
+	connection.SetCache(cache)
+	for _, path := range []string{"/etag", "/stale"} {
+		for i := 0; i < 3; i++ {
+			var data ReturnData
+			if err := connection.GetJSON(path, &data); err != nil {
+				t.Fatalf("Error getting JSON: %v", err.Error())
+			}
+			if data.StringData != path {
+				t.Errorf("Expected '%v', got '%v' instead.", path, data.StringData)
+			}
+		}
+		if count(path) != 3 {
+			t.Errorf("Expected 3 requests to %v, got %v instead.", path, count(path))
+		}
+	}
+	stats := cache.Stats()
+	if stats.Revalidations != 4 || stats.Misses != 2 || stats.Hits != 0 {
+		t.Errorf("Expected 4 revalidations and 2 misses, got %+v instead.", stats)
+	}
+}
+
+func TestHTTPCache_Directives(t *testing.T) {
+	server, count := newCacheServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetCache(NewHTTPCache(NewMemoryCache(1 << 20)))
+
+	connection.Get("/nostore")
+	connection.Get("/nostore")
+	if count("/nostore") != 2 {
+		t.Errorf("Expected no-store responses not to be cached, got %v requests instead.", count("/nostore"))
+	}
+
+	connection.SendHeaders = HeaderList{"Accept-Language": "de"}
+	connection.Get("/vary")
+	connection.Get("/vary")
+	connection.SendHeaders = HeaderList{"Accept-Language": "en"}
+	connection.Get("/vary")
+	if count("/vary") != 2 {
+		t.Errorf("Expected a request per Accept-Language, got %v requests instead.", count("/vary"))
+	}
+
+	connection.SendHeaders = HeaderList{"Cache-Control": "no-cache"}
+	connection.Get("/vary")
+	if count("/vary") != 3 {
+		t.Errorf("Expected no-cache to bypass the entry, got %v requests instead.", count("/vary"))
+	}
+
+	connection.SendHeaders = HeaderList{"Cache-Control": "only-if-cached"}
+	_, err := connection.Get("/missing")
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected a 504 StatusError for only-if-cached, got '%v' instead.", err)
+	}
+	if count("/missing") != 0 {
+		t.Errorf("Expected no request for only-if-cached, got %v instead.", count("/missing"))
+	}
+}
+
+func TestHTTPCache_Disk(t *testing.T) {
+	server, count := newCacheServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		store, err := NewDiskCache(dir)
+		if err != nil {
+			t.Fatalf("Error creating disk cache: %v", err.Error())
+		}
+		connection := newTestConnection(t, server)
+		connection.SetCache(NewHTTPCache(store))
+		b, err := connection.Get("/fresh")
+		if err != nil || string(b) != `{"method":"GET","stringdata":"/fresh"}` {
+			t.Errorf("Expected the cached body, got '%v' and '%v' instead.", string(b), err)
+		}
+	}
+	if count("/fresh") != 1 {
+		t.Errorf("Expected the disk cache to persist the entry, got %v requests instead.", count("/fresh"))
+	}
+}
+
+func TestHTTPCache_Stream(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-time.After(time.Second * 2):
+		}
+		w.Write([]byte("second\n"))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	cache := NewHTTPCache(NewMemoryCache(1 << 20))
+	connection.SetCache(cache)
+	start := time.Now()
+	response, err := connection.GetStream("/stream")
+	if err != nil {
+		t.Fatalf("Error getting stream: %v", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the stream to return when the headers arrived, took %v.", elapsed)
+	}
+	line, err := bufio.NewReader(response.Body).ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Errorf("Expected the first line, got '%v' and '%v' instead.", line, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(response.Body)
+	response.Close()
+	if err != nil || string(rest) != "second\n" {
+		t.Errorf("Expected the second line, got '%v' and '%v' instead.", string(rest), err)
+	}
+	if stats := cache.Stats(); stats.Stores != 1 {
+		t.Errorf("Expected the read stream to be stored, got %+v instead.", stats)
+	}
+
+	b, err := connection.Get("/stream")
+	if err != nil || string(b) != "first\nsecond\n" {
+		t.Errorf("Expected the stored stream, got '%v' and '%v' instead.", string(b), err)
+	}
+	if stats := cache.Stats(); stats.Revalidations != 1 {
+		t.Errorf("Expected a revalidation, got %+v instead.", stats)
+	}
+}
+
+func TestHTTPCache_Decompression(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write([]byte(`{"stringdata":"compressed"}`))
+		writer.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetResponseDecompression(true)
+	cache := NewHTTPCache(NewMemoryCache(1 << 20))
+	connection.SetCache(cache)
+	for i := 0; i < 3; i++ {
+		var data ReturnData
+		if err := connection.GetJSON("/gzip", &data); err != nil || data.StringData != "compressed" {
+			t.Errorf("Expected the decompressed response, got '%v' and '%v' instead.", data.StringData, err)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || count != 1 {
+		t.Errorf("Expected 2 hits and 1 request, got %+v and %v requests instead.", stats, count)
+	}
+}
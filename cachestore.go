@@ -0,0 +1,150 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStore stores the serialized entries of a HTTPCache by key. Stores are
+// best effort, a value may be dropped at any time.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCache is a CacheStore keeping the entries in memory. When the size of
+// all values exceeds the limit, the least recently used entries are removed.
+type MemoryCache struct {
+	maxBytes int64
+	mu       sync.Mutex
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache creates a MemoryCache holding up to maxBytes bytes of values.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for key and marks it as recently used.
+func (cache *MemoryCache) Get(key string) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	element, ok := cache.items[key]
+	if !ok {
+		return nil, false
+	}
+	cache.lru.MoveToFront(element)
+	return element.Value.(*memoryItem).value, true
+}
+
+// Set stores value for key. Values larger than the limit are not stored.
+func (cache *MemoryCache) Set(key string, value []byte) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.remove(key)
+	if int64(len(value)) > cache.maxBytes {
+		return
+	}
+	cache.items[key] = cache.lru.PushFront(&memoryItem{key: key, value: value})
+	cache.size += int64(len(value))
+	for cache.size > cache.maxBytes {
+		cache.remove(cache.lru.Back().Value.(*memoryItem).key)
+	}
+}
+
+// Delete removes the value stored for key.
+func (cache *MemoryCache) Delete(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.remove(key)
+}
+
+// Size returns the size of all stored values in bytes.
+func (cache *MemoryCache) Size() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.size
+}
+
+func (cache *MemoryCache) remove(key string) {
+	element, ok := cache.items[key]
+	if !ok {
+		return
+	}
+	cache.lru.Remove(element)
+	delete(cache.items, key)
+	cache.size -= int64(len(element.Value.(*memoryItem).value))
+}
+
+// DiskCache is a CacheStore keeping every entry in a file of a directory. The
+// files are named by the SHA-256 hash of the key. Entries are never evicted,
+// stale entries are replaced when the response is stored again.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a DiskCache in dir, which is created if it does not exist.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get returns the value stored for key.
+func (cache *DiskCache) Get(key string) ([]byte, bool) {
+	value, err := os.ReadFile(cache.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set stores value for key. The file is replaced atomically, so concurrent
+// readers see either the previous or the new value.
+func (cache *DiskCache) Set(key string, value []byte) {
+	f, err := os.CreateTemp(cache.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), cache.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete removes the value stored for key.
+func (cache *DiskCache) Delete(key string) {
+	os.Remove(cache.path(key))
+}
+
+func (cache *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(cache.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,45 @@
+package lra
+
+import (
+	"testing"
+)
+
+func TestMemoryCache_LRU(t *testing.T) {
+	cache := NewMemoryCache(10)
+	cache.Set("a", []byte("1234"))
+	cache.Set("b", []byte("1234"))
+	cache.Get("a")
+	cache.Set("c", []byte("1234"))
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	if v, ok := cache.Get("a"); !ok || string(v) != "1234" {
+		t.Errorf("Expected entry a to be kept, got '%v' instead.", string(v))
+	}
+	if cache.Size() != 8 {
+		t.Errorf("Expected a size of 8, got %v instead.", cache.Size())
+	}
+	cache.Set("d", []byte("12345678901"))
+	if _, ok := cache.Get("d"); ok {
+		t.Errorf("Expected a value above the limit not to be stored")
+	}
+	cache.Delete("a")
+	if cache.Size() != 4 {
+		t.Errorf("Expected a size of 4 after deleting, got %v instead.", cache.Size())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating disk cache: %v", err.Error())
+	}
+	cache.Set("GET http://localhost/", []byte("value"))
+	if v, ok := cache.Get("GET http://localhost/"); !ok || string(v) != "value" {
+		t.Errorf("Expected 'value', got '%v' instead.", string(v))
+	}
+	cache.Delete("GET http://localhost/")
+	if _, ok := cache.Get("GET http://localhost/"); ok {
+		t.Errorf("Expected the entry to be deleted")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.yaml.in/yaml/v3"
+)
+
+// Codec encodes request bodies and decodes response bodies of one media type.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+// JSONCodec encodes JSON with encoding/json.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal parses the JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// ContentType returns application/json.
+func (JSONCodec) ContentType() string { return "application/json" }
+
+// XMLCodec encodes XML with encoding/xml.
+type XMLCodec struct{}
+
+// Marshal encodes v as XML.
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) { return xml.Marshal(v) }
+
+// Unmarshal parses the XML data into v. Documents declaring an encoding other
+// than UTF-8 are converted.
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	return decoder.Decode(v)
+}
+
+// ContentType returns application/xml.
+func (XMLCodec) ContentType() string { return "application/xml" }
+
+// YAMLCodec encodes YAML using the `yaml` struct tags.
+type YAMLCodec struct{}
+
+// Marshal encodes v as YAML.
+func (YAMLCodec) Marshal(v interface{}) ([]byte, error) { return yaml.Marshal(v) }
+
+// Unmarshal parses the YAML data into v.
+func (YAMLCodec) Unmarshal(data []byte, v interface{}) error { return yaml.Unmarshal(data, v) }
+
+// ContentType returns application/yaml.
+func (YAMLCodec) ContentType() string { return "application/yaml" }
+
+// MsgPackCodec encodes MessagePack using the `msgpack` struct tags or, if those
+// are missing, the `json` struct tags.
+type MsgPackCodec struct{}
+
+// Marshal encodes v as MessagePack.
+func (MsgPackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses the MessagePack data into v.
+func (MsgPackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
+
+// ContentType returns application/msgpack.
+func (MsgPackCodec) ContentType() string { return "application/msgpack" }
+
+// CBORCodec encodes CBOR (RFC 8949) using the `cbor` struct tags or, if those are
+// missing, the `json` struct tags.
+type CBORCodec struct{}
+
+// Marshal encodes v as CBOR.
+func (CBORCodec) Marshal(v interface{}) ([]byte, error) { return cbor.Marshal(v) }
+
+// Unmarshal parses the CBOR data into v.
+func (CBORCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+
+// ContentType returns application/cbor.
+func (CBORCodec) ContentType() string { return "application/cbor" }
+
+// builtinCodecs are the codecs known without registration by media type.
+var builtinCodecs = map[string]Codec{
+	"application/json":                JSONCodec{},
+	"application/xml":                 XMLCodec{},
+	"text/xml":                        XMLCodec{},
+	"application/yaml":                YAMLCodec{},
+	"application/x-yaml":              YAMLCodec{},
+	"text/yaml":                       YAMLCodec{},
+	"application/msgpack":             MsgPackCodec{},
+	"application/x-msgpack":           MsgPackCodec{},
+	"application/vnd.msgpack":         MsgPackCodec{},
+	"application/cbor":                CBORCodec{},
+	"application/x-protobuf":          ProtobufCodec{},
+	"application/protobuf":            ProtobufCodec{},
+	"application/vnd.google.protobuf": ProtobufCodec{},
+}
+
+// RegisterCodec registers codec for its content type and the additional media
+// types given. Registered codecs take precedence over the built-in JSON, XML,
+// YAML, MessagePack, CBOR and Protocol Buffers codecs.
+func (connection *Connection) RegisterCodec(codec Codec, mediaTypes ...string) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if connection.codecs == nil {
+		connection.codecs = make(map[string]Codec)
+	}
+	for _, mediaType := range append([]string{codec.ContentType()}, mediaTypes...) {
+		if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+			mediaType = parsed
+		}
+		connection.codecs[strings.ToLower(mediaType)] = codec
+	}
+}
+
+// SetDefaultCodec sets the codec Send uses to encode request bodies and to decode
+// responses without a known Content-Type. The default is JSONCodec.
+func (connection *Connection) SetDefaultCodec(codec Codec) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	connection.codec = codec
+}
+
+// DefaultCodec returns the codec set with SetDefaultCodec.
+func (connection *Connection) DefaultCodec() Codec {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if connection.codec == nil {
+		return JSONCodec{}
+	}
+	return connection.codec
+}
+
+// Codec returns the codec for contentType or nil if there is none. Parameters of
+// the content type are ignored. Structured syntax suffixes like
+// application/problem+json use the codec of the suffix.
+func (connection *Connection) Codec(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	candidates := []string{mediaType}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		candidates = append(candidates, "application/"+mediaType[i+1:])
+	}
+	for _, candidate := range candidates {
+		if codec, ok := connection.codecs[candidate]; ok {
+			return codec
+		}
+		if codec, ok := builtinCodecs[candidate]; ok {
+			return codec
+		}
+	}
+	return nil
+}
+
+// Send issues a HTTP request with body encoded by the default codec and decodes
+// the response into result with the codec matching the Content-Type of the
+// response, or the default codec if there is none. The Accept header asks for the
+// content type of the default codec. A nil body sends no body, a nil result skips
+// decoding.
+func (connection *Connection) Send(method string, endpoint string, body interface{}, result interface{}, options ...RequestOption) error {
+	codec := connection.DefaultCodec()
+	header := http.Header{"Accept": {codec.ContentType()}}
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = codec.Marshal(body)
+		if err != nil {
+			return err
+		}
+		header.Set("Content-Type", codec.ContentType())
+	}
+	response, responseHeader, err := connection.requestHeader(method, endpoint, bytes.NewReader(data), int64(len(data)), header, options...)
+	if result == nil || responseHeader == nil {
+		return err
+	}
+	return connection.decodeResponse(codec, response, responseHeader, err, result)
+}
+
+// Receive issues a HTTP GET request and decodes the response into result, see Send.
+func (connection *Connection) Receive(endpoint string, result interface{}, options ...RequestOption) error {
+	return connection.Send("GET", endpoint, nil, result, options...)
+}
+
+// decodeResponse decodes response with the codec for its Content-Type or codec,
+// after converting it to UTF-8 if it has another charset. HTML responses are not
+// decoded. Like for the *JSON methods, err takes precedence if decoding fails.
+func (connection *Connection) decodeResponse(codec Codec, response []byte, header http.Header, err error, result interface{}) error {
+	contentType := header.Get("Content-Type")
+	if isHTML(contentType) {
+		return contentTypeError(contentType, response, err)
+	}
+	if c := connection.Codec(contentType); c != nil {
+		codec = c
+	}
+	response, err2 := toUTF8(response, contentType)
+	if err2 == nil {
+		if _, ok := codec.(XMLCodec); ok && contentCharset(contentType) != "" {
+			err2 = unmarshalUTF8XML(response, result)
+		} else {
+			err2 = codec.Unmarshal(response, result)
+		}
+	}
+	if err2 != nil {
+		if err != nil {
+			return err
+		}
+		return err2
+	}
+	return err
+}
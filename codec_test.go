@@ -0,0 +1,118 @@
+package lra
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type codecItem struct {
+	Name  string `json:"name" yaml:"name" xml:"name"`
+	Count int    `json:"count" yaml:"count" xml:"count"`
+}
+
+// newCodecServer decodes the request body with the codec of its Content-Type,
+// increments Count and encodes the result with the codec of the Accept header.
+func newCodecServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/problem" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"name":"problem","count":400}`))
+			return
+		}
+		item := codecItem{Name: "get"}
+		if r.Method != "GET" {
+			b, _ := io.ReadAll(r.Body)
+			if err := builtinCodecs[r.Header.Get("Content-Type")].Unmarshal(b, &item); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		item.Count++
+		codec := builtinCodecs[r.Header.Get("Accept")]
+		b, _ := codec.Marshal(item)
+		w.Header().Set("Content-Type", codec.ContentType()+"; charset=utf-8")
+		w.Write(b)
+	}))
+}
+
+func TestSend_Codecs(t *testing.T) {
+	server := newCodecServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, codec := range []Codec{JSONCodec{}, XMLCodec{}, YAMLCodec{}, MsgPackCodec{}, CBORCodec{}} {
+		connection.SetDefaultCodec(codec)
+		var result codecItem
+		if err := connection.Send("POST", "/items", codecItem{Name: "item", Count: 41}, &result); err != nil {
+			t.Fatalf("Error sending %v: %v", codec.ContentType(), err.Error())
+		}
+		if result.Name != "item" || result.Count != 42 {
+			t.Errorf("Expected item 42 via %v, got %v %v instead.", codec.ContentType(), result.Name, result.Count)
+		}
+		result = codecItem{}
+		if err := connection.Receive("/items", &result); err != nil {
+			t.Fatalf("Error receiving %v: %v", codec.ContentType(), err.Error())
+		}
+		if result.Name != "get" || result.Count != 1 {
+			t.Errorf("Expected get 1 via %v, got %v %v instead.", codec.ContentType(), result.Name, result.Count)
+		}
+	}
+}
+
+func TestSend_ErrorDecoded(t *testing.T) {
+	server := newCodecServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetDefaultCodec(XMLCodec{})
+	var result codecItem
+	err := connection.Receive("/problem", &result)
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a StatusError with status 400, got '%v' instead.", err)
+	}
+	if result.Name != "problem" {
+		t.Errorf("Expected the problem+json body to be decoded as JSON, got '%v' instead.", result.Name)
+	}
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(string))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = strings.ToLower(string(data))
+	return nil
+}
+
+func (upperCodec) ContentType() string { return "text/x-upper" }
+
+func TestCodec_Lookup(t *testing.T) {
+	connection := new(Connection)
+	if _, ok := connection.DefaultCodec().(JSONCodec); !ok {
+		t.Errorf("Expected JSONCodec as default, got %T instead.", connection.DefaultCodec())
+	}
+	if _, ok := connection.Codec("text/xml; charset=utf-8").(XMLCodec); !ok {
+		t.Errorf("Expected XMLCodec for text/xml, got %T instead.", connection.Codec("text/xml"))
+	}
+	if _, ok := connection.Codec("application/vnd.api+cbor").(CBORCodec); !ok {
+		t.Errorf("Expected CBORCodec for +cbor, got %T instead.", connection.Codec("application/vnd.api+cbor"))
+	}
+	if connection.Codec("text/x-upper") != nil {
+		t.Errorf("Expected no codec for text/x-upper, got %T instead.", connection.Codec("text/x-upper"))
+	}
+	connection.RegisterCodec(upperCodec{}, "application/json")
+	if _, ok := connection.Codec("text/x-upper").(upperCodec); !ok {
+		t.Errorf("Expected the registered codec, got %T instead.", connection.Codec("text/x-upper"))
+	}
+	if _, ok := connection.Codec("application/json").(upperCodec); !ok {
+		t.Errorf("Expected the registered codec to override JSON, got %T instead.", connection.Codec("application/json"))
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor is a reusable compressing writer.
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// compressors are pools of compressing writers by content coding. Deflate is the
+// zlib format as required by RFC 9110.
+var compressors = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	"deflate": {New: func() interface{} {
+		return zlib.NewWriter(io.Discard)
+	}},
+	"zstd": {New: func() interface{} {
+		w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// SetRequestCompression compresses request bodies of at least threshold bytes
+// with the content coding encoding, which can be gzip, deflate or zstd, and sets
+// the Content-Encoding header accordingly. An empty encoding disables compression.
+//
+// Only bodies of known length are compressed, bodies sent with chunked transfer
+// encoding (a length of -1) and requests which already have a Content-Encoding in
+// SendHeaders, their header or request options are sent as they are. Compressed
+// bodies are streamed without buffering and sent with chunked transfer encoding.
+func (connection *Connection) SetRequestCompression(encoding string, threshold int) error {
+	if _, ok := compressors[encoding]; !ok && encoding != "" {
+		return fmt.Errorf("unsupported content coding %q", encoding)
+	}
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	connection.compression = encoding
+	connection.compressionThreshold = threshold
+	return nil
+}
+
+// requestCompression returns the content coding to compress a body of length with
+// or an empty string if it is sent uncompressed. Bodies are sent uncompressed if
+// the SendHeaders, header or the request options set or remove Content-Encoding,
+// as the header would no longer describe the body.
+func (connection *Connection) requestCompression(length int64, header http.Header, o *requestOptions) string {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if connection.compression == "" || length <= 0 || length < int64(connection.compressionThreshold) {
+		return ""
+	}
+	for h := range connection.SendHeaders {
+		if http.CanonicalHeaderKey(h) == "Content-Encoding" {
+			return ""
+		}
+	}
+	for h := range header {
+		if http.CanonicalHeaderKey(h) == "Content-Encoding" {
+			return ""
+		}
+	}
+	if o != nil {
+		if _, ok := o.header["Content-Encoding"]; ok {
+			return ""
+		}
+		for _, h := range o.remove {
+			if http.CanonicalHeaderKey(h) == "Content-Encoding" {
+				return ""
+			}
+		}
+	}
+	return connection.compression
+}
+
+// setCompressedBody sets the first length bytes of body compressed with encoding
+// as body of req. The body is compressed while it is sent and therefore sent with
+// chunked transfer encoding, see setBody. If body is an io.Seeker, the request
+// can be sent again, e.g. on redirects.
+func setCompressedBody(req *http.Request, encoding string, body io.Reader, length int64) {
+	seeker, ok := body.(io.Seeker)
+	var offset int64
+	var err error
+	if ok {
+		offset, err = seeker.Seek(0, io.SeekCurrent)
+	}
+	current := compress(encoding, io.LimitReader(body, length))
+	req.Body = current
+	req.ContentLength = -1
+	if ok && err == nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			// Stop reading body for the previous attempt before rewinding it.
+			current.Close()
+			<-current.done
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			current = compress(encoding, io.LimitReader(body, length))
+			return current, nil
+		}
+	}
+}
+
+// compressedBody is a reader of a body compressed by a goroutine, which is
+// started by the first Read. Done is closed when the goroutine stopped reading the
+// body or, if it was never started, when the reader is closed.
+type compressedBody struct {
+	*io.PipeReader
+	w        *io.PipeWriter
+	encoding string
+	body     io.Reader
+	once     sync.Once
+	done     chan struct{}
+}
+
+// compress returns a reader of body compressed with encoding. The body is read
+// and compressed by a goroutine as the returned reader is read, which must be
+// read to the end or closed once reading started.
+func compress(encoding string, body io.Reader) *compressedBody {
+	r, w := io.Pipe()
+	return &compressedBody{
+		PipeReader: r,
+		w:          w,
+		encoding:   encoding,
+		body:       body,
+		done:       make(chan struct{}),
+	}
+}
+
+func (compressed *compressedBody) Read(b []byte) (int, error) {
+	compressed.once.Do(func() {
+		go compressed.compress()
+	})
+	return compressed.PipeReader.Read(b)
+}
+
+// Close closes the reader. A goroutine which was not started yet is not started
+// anymore.
+func (compressed *compressedBody) Close() error {
+	err := compressed.PipeReader.Close()
+	compressed.once.Do(func() {
+		close(compressed.done)
+	})
+	return err
+}
+
+func (compressed *compressedBody) compress() {
+	defer close(compressed.done)
+	pool := compressors[compressed.encoding]
+	c := pool.Get().(compressor)
+	c.Reset(compressed.w)
+	_, err := io.Copy(c, compressed.body)
+	if err == nil {
+		err = c.Close()
+	}
+	// Do not keep the pipe referenced from the pool.
+	c.Reset(io.Discard)
+	pool.Put(c)
+	compressed.w.CloseWithError(err)
+}
@@ -0,0 +1,208 @@
+package lra
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// newDecompressServer echoes the decompressed request body and reports the
+// Content-Encoding and the size of the body as received.
+func newDecompressServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, _ := io.ReadAll(r.Body)
+		var reader io.Reader = bytes.NewReader(compressed)
+		var err error
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			reader, err = gzip.NewReader(reader)
+		case "deflate":
+			reader, err = zlib.NewReader(reader)
+		case "zstd":
+			var decoder *zstd.Decoder
+			decoder, err = zstd.NewReader(reader)
+			if err == nil {
+				defer decoder.Close()
+				reader = decoder
+			}
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(reader)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Compressed-Length", strconv.Itoa(len(compressed)))
+		w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+		w.Write(b)
+	}))
+}
+
+func TestSetRequestCompression(t *testing.T) {
+	server := newDecompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	payload := bytes.Repeat(indata, 100)
+	for _, encoding := range []string{"gzip", "deflate", "zstd"} {
+		if err := connection.SetRequestCompression(encoding, 1024); err != nil {
+			t.Fatalf("Error setting compression: %v", err.Error())
+		}
+		for i := 0; i < 3; i++ {
+			response, err := connection.PostStream("/bulk", payload)
+			if err != nil {
+				t.Fatalf("Error posting %v body: %v", encoding, err.Error())
+			}
+			b, _ := io.ReadAll(response.Body)
+			response.Close()
+			if !bytes.Equal(b, payload) {
+				t.Errorf("Expected the decompressed payload for %v, got %v bytes instead.", encoding, len(b))
+			}
+			if response.Header.Get("X-Content-Encoding") != encoding {
+				t.Errorf("Expected Content-Encoding %v, got '%v' instead.", encoding, response.Header.Get("X-Content-Encoding"))
+			}
+			if n, _ := strconv.Atoi(response.Header.Get("X-Compressed-Length")); n >= len(payload) {
+				t.Errorf("Expected a compressed body for %v, got %v bytes instead.", encoding, n)
+			}
+		}
+
+		b, err := connection.Post("/small", indata)
+		if err != nil || !bytes.Equal(b, indata) {
+			t.Errorf("Expected the small body echoed, got '%v' and '%v' instead.", string(b), err)
+		}
+	}
+
+	if err := connection.SetRequestCompression("br", 0); err == nil {
+		t.Errorf("Expected an error for an unsupported coding, got nil")
+	}
+}
+
+func TestSetRequestCompression_Threshold(t *testing.T) {
+	server := newDecompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetRequestCompression("gzip", len(indata)+1)
+	response, err := connection.PostStream("/small", indata)
+	if err != nil {
+		t.Fatalf("Error posting body: %v", err.Error())
+	}
+	response.Close()
+	if response.Header.Get("X-Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding below the threshold, got '%v' instead.", response.Header.Get("X-Content-Encoding"))
+	}
+}
+
+func TestSetRequestCompression_Streaming(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		buf := make([]byte, 1024)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		close(received)
+		n, _ := io.Copy(io.Discard, reader)
+		w.Header().Set("X-Length", strconv.FormatInt(n+int64(len(buf)), 10))
+		w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetRequestCompression("gzip", 0)
+	half := make([]byte, 512*1024)
+	rand.Read(half)
+	body, w := io.Pipe()
+	go func() {
+		w.Write(half)
+		// The second half is only written after the server got the first one,
+		// which requires the body to be compressed while it is sent.
+		select {
+		case <-received:
+			w.Write(half)
+			w.Close()
+		case <-time.After(time.Second * 5):
+			w.CloseWithError(context.DeadlineExceeded)
+		}
+	}()
+	response, err := connection.stream(context.Background(), "POST", "/bulk", body, int64(2*len(half)), nil)
+	if err != nil {
+		t.Fatalf("Error posting body: %v", err.Error())
+	}
+	response.Close()
+	if response.Header.Get("X-Length") != strconv.Itoa(2*len(half)) {
+		t.Errorf("Expected %v bytes, got '%v' instead.", 2*len(half), response.Header.Get("X-Length"))
+	}
+	if response.Header.Get("X-Transfer-Encoding") != "chunked" {
+		t.Errorf("Expected chunked transfer encoding, got '%v' instead.", response.Header.Get("X-Transfer-Encoding"))
+	}
+}
+
+func TestSetRequestCompression_HeaderOption(t *testing.T) {
+	server := newDecompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetRequestCompression("zstd", 0)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(indata)
+	w.Close()
+	b, err := connection.Post("/precompressed", buf.Bytes(), WithHeader("Content-Encoding", "gzip"))
+	if err != nil || !bytes.Equal(b, indata) {
+		t.Errorf("Expected the precompressed body to be sent as it is, got '%v' and '%v' instead.", string(b), err)
+	}
+
+	response, err := connection.PostStream("/plain", indata, WithoutHeader("Content-Encoding"))
+	if err != nil {
+		t.Fatalf("Error posting body: %v", err.Error())
+	}
+	response.Close()
+	if response.Header.Get("X-Content-Encoding") != "" || response.Header.Get("X-Compressed-Length") != strconv.Itoa(len(indata)) {
+		t.Errorf("Expected an uncompressed body, got '%v' with %v bytes instead.", response.Header.Get("X-Content-Encoding"), response.Header.Get("X-Compressed-Length"))
+	}
+}
+
+func TestSetRequestCompression_NotSent(t *testing.T) {
+	server := newDecompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetRequestCompression("gzip", 0)
+	breaker := NewCircuitBreaker("open", CircuitBreakerSettings{})
+	breaker.setState(CircuitOpen, time.Now())
+	connection.SetCircuitBreaker("/rejected", breaker)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := connection.PostReader("/rejected", bytes.NewReader(indata), int64(len(indata))); err != ErrCircuitOpen {
+			t.Fatalf("Expected ErrCircuitOpen, got '%v' instead.", err)
+		}
+		if _, err := connection.NewRequest("POST", "/built").Body(bytes.NewReader(indata), int64(len(indata))).Build(context.Background()); err != nil {
+			t.Fatalf("Error building request: %v", err.Error())
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("Expected no compressing goroutines for requests not sent, got %v goroutines instead of %v.", after, before)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ContentTypeError is returned by the *JSON methods and Send when the response
+// has a Content-Type which can not be decoded, e.g. the HTML error page of a proxy.
+// If the response also has a status code above 399, the *StatusError is returned
+// instead.
+type ContentTypeError struct {
+	ContentType string
+	Body        []byte
+}
+
+// Error describes the unexpected content type.
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("unexpected content type %q", e.ContentType)
+}
+
+// requestJSON sends a request like requestReader and parses the response as JSON
+// into data. Accept and, if a body is sent, Content-Type default to
+// application/json unless they are set in SendHeaders or header.
+func (connection *Connection) requestJSON(method string, endpoint string, body io.Reader, length int64, header http.Header, data interface{}, options ...RequestOption) error {
+	header = connection.defaultHeader(header, "Accept", "application/json")
+	if body != nil && length != 0 {
+		header = connection.defaultHeader(header, "Content-Type", "application/json")
+	}
+	response, responseHeader, err := connection.requestHeader(method, endpoint, body, length, header, options...)
+	return connection.decodeJSON(method, response, responseHeader, err, data)
+}
+
+// decodeJSON parses the response to a request with method as JSON into data. The
+// error of the request takes precedence over parse errors.
+func (connection *Connection) decodeJSON(method string, response []byte, header http.Header, err error, data interface{}) error {
+	if method == "HEAD" || header == nil {
+		// HEAD returns the headers themselves as JSON.
+		return unmarshalResponse(response, err, data)
+	}
+	contentType := header.Get("Content-Type")
+	if c := connection.Codec(contentType); c != nil {
+		if _, ok := c.(JSONCodec); !ok {
+			return contentTypeError(contentType, response, err)
+		}
+	}
+	return connection.decodeResponse(JSONCodec{}, response, header, err, data)
+}
+
+// defaultHeader returns header with name set to value, if neither header nor the
+// SendHeaders of the connection contain name.
+func (connection *Connection) defaultHeader(header http.Header, name string, value string) http.Header {
+	if header.Get(name) != "" {
+		return header
+	}
+	for h := range connection.SendHeaders {
+		if http.CanonicalHeaderKey(h) == name {
+			return header
+		}
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(name, value)
+	return header
+}
+
+// contentTypeError returns err if it is set or a *ContentTypeError.
+func contentTypeError(contentType string, response []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	e := &ContentTypeError{ContentType: contentType, Body: response}
+	if len(e.Body) > maxErrorBody {
+		e.Body = e.Body[:maxErrorBody]
+	}
+	return e
+}
+
+// isHTML reports if contentType is a HTML document, which is never decoded.
+func isHTML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// contentCharset returns the charset parameter of contentType in lower case.
+func contentCharset(contentType string) string {
+	_, params, _ := mime.ParseMediaType(contentType)
+	return strings.ToLower(params["charset"])
+}
+
+// toUTF8 converts body from the charset given in contentType to UTF-8.
+func toUTF8(body []byte, contentType string) ([]byte, error) {
+	charset := contentCharset(contentType)
+	if charset == "" || charset == "utf-8" || charset == "utf8" || charset == "us-ascii" {
+		return body, nil
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return encoding.NewDecoder().Bytes(body)
+}
+
+// charsetReader returns a reader converting input from charset to UTF-8, for the
+// encoding declared in XML documents.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+// unmarshalUTF8XML parses data, which was converted to UTF-8 from the charset of
+// the Content-Type, as XML into v. The charset of the Content-Type takes
+// precedence over the encoding declared in the document (RFC 7303), so the
+// declaration is ignored.
+func unmarshalUTF8XML(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
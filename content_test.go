@@ -0,0 +1,124 @@
+package lra
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newContentServer reports the Accept and Content-Type headers of the request
+// and answers /html with a HTML page and /latin1 with ISO-8859-1 encoded JSON.
+func newContentServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><body>Bad Gateway</body></html>"))
+		case "/html-error":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html><body>Bad Gateway</body></html>"))
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte("<data/>"))
+		case "/latin1":
+			w.Header().Set("Content-Type", "application/json; charset=ISO-8859-1")
+			w.Write([]byte("{\"stringdata\":\"J\xf6rn\"}"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"method":"` + r.Header.Get("Accept") + `","stringdata":"` + r.Header.Get("Content-Type") + `"}`))
+		}
+	}))
+}
+
+func TestJSON_DefaultHeaders(t *testing.T) {
+	server := newContentServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var data ReturnData
+	if err := connection.GetJSON("/headers", &data); err != nil {
+		t.Fatalf("Error getting JSON: %v", err.Error())
+	}
+	if data.Method != "application/json" || data.StringData != "" {
+		t.Errorf("Expected Accept application/json and no Content-Type, got '%v' and '%v' instead.", data.Method, data.StringData)
+	}
+	if err := connection.PostJSON("/headers", indata, &data); err != nil {
+		t.Fatalf("Error posting JSON: %v", err.Error())
+	}
+	if data.Method != "application/json" || data.StringData != "application/json" {
+		t.Errorf("Expected Accept and Content-Type application/json, got '%v' and '%v' instead.", data.Method, data.StringData)
+	}
+
+	connection.SendHeaders = HeaderList{"accept": "application/vnd.test+json", "content-type": "application/vnd.test+json"}
+	if err := connection.PostJSON("/headers", indata, &data); err != nil {
+		t.Fatalf("Error posting JSON: %v", err.Error())
+	}
+	if data.Method != "application/vnd.test+json" || data.StringData != "application/vnd.test+json" {
+		t.Errorf("Expected the headers from SendHeaders, got '%v' and '%v' instead.", data.Method, data.StringData)
+	}
+}
+
+func TestJSON_ContentTypeError(t *testing.T) {
+	server := newContentServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, endpoint := range []string{"/html", "/xml"} {
+		var data ReturnData
+		err := connection.GetJSON(endpoint, &data)
+		var contentTypeError *ContentTypeError
+		if !errors.As(err, &contentTypeError) {
+			t.Fatalf("Expected a ContentTypeError for %v, got '%v' instead.", endpoint, err)
+		}
+		if len(contentTypeError.Body) == 0 {
+			t.Errorf("Expected the body in the ContentTypeError, got none")
+		}
+	}
+
+	var data ReturnData
+	err := connection.GetJSON("/html-error", &data)
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected a StatusError with status 502, got '%v' instead.", err)
+	}
+}
+
+func TestJSON_Charset(t *testing.T) {
+	server := newContentServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var data ReturnData
+	if err := connection.GetJSON("/latin1", &data); err != nil {
+		t.Fatalf("Error getting JSON: %v", err.Error())
+	}
+	if data.StringData != "Jörn" {
+		t.Errorf("Expected 'Jörn', got '%v' instead.", data.StringData)
+	}
+	if err := connection.Receive("/latin1", &data); err != nil || data.StringData != "Jörn" {
+		t.Errorf("Expected 'Jörn' via Receive, got '%v' and '%v' instead.", data.StringData, err)
+	}
+}
+
+func TestXML_Charset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		declaration := `<?xml version="1.0" encoding="ISO-8859-1"?>`
+		if r.URL.Path == "/declared" {
+			w.Header().Set("Content-Type", "application/xml")
+		} else {
+			w.Header().Set("Content-Type", "application/xml; charset=iso-8859-1")
+		}
+		w.Write([]byte(declaration + "<ReturnData><StringData>J\xf6rn</StringData></ReturnData>"))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, endpoint := range []string{"/header", "/declared"} {
+		var data ReturnData
+		if err := connection.Receive(endpoint, &data); err != nil || data.StringData != "Jörn" {
+			t.Errorf("Expected 'Jörn' from %v, got '%v' and '%v' instead.", endpoint, data.StringData, err)
+		}
+	}
+}
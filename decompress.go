@@ -0,0 +1,196 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// AcceptEncoding is the Accept-Encoding header sent when response decompression
+// is enabled with SetResponseDecompression.
+const AcceptEncoding = "zstd, br, gzip, deflate"
+
+var zstdDecoders = sync.Pool{New: func() interface{} {
+	d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	return d
+}}
+
+// SetResponseDecompression enables or disables sending the Accept-Encoding header
+// AcceptEncoding with every request, unless SendHeaders contains one.
+//
+// Responses with a Content-Encoding of zstd, br, gzip or deflate are decoded in
+// any case, also if the encoding was requested by an Accept-Encoding header in
+// SendHeaders. The Content-Encoding and Content-Length headers are removed from
+// decoded responses. A streamed Response reports the original encoding in
+// ContentEncoding and the number of compressed bytes read in CompressedSize.
+func (connection *Connection) SetResponseDecompression(enabled bool) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	connection.decompression = enabled
+}
+
+// acceptEncoding returns the Accept-Encoding header to add to requests or an
+// empty string.
+func (connection *Connection) acceptEncoding() string {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if !connection.decompression {
+		return ""
+	}
+	for h := range connection.SendHeaders {
+		if http.CanonicalHeaderKey(h) == "Accept-Encoding" {
+			return ""
+		}
+	}
+	return AcceptEncoding
+}
+
+// decodedBody is a response body decoded from one or more content codings. The
+// decoders are created when the body is read first, so empty bodies of e.g.
+// redirects do not fail.
+type decodedBody struct {
+	body     io.ReadCloser
+	codings  []string
+	counter  *countingReader
+	reader   io.Reader
+	closers  []func()
+	err      error
+	encoding string
+}
+
+// decompressResponse replaces the body of r by a decoding body if r has a
+// supported Content-Encoding and returns it, otherwise it returns nil.
+func decompressResponse(r *http.Response) *decodedBody {
+	if r.Request != nil && r.Request.Method == "HEAD" || r.StatusCode == http.StatusNoContent || r.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	encoding := strings.Join(r.Header.Values("Content-Encoding"), ",")
+	var codings []string
+	for _, coding := range strings.Split(encoding, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+		case "zstd", "br", "gzip", "x-gzip", "deflate":
+			codings = append(codings, coding)
+		default:
+			return nil
+		}
+	}
+	if len(codings) == 0 {
+		return nil
+	}
+	d := &decodedBody{
+		body:     r.Body,
+		codings:  codings,
+		counter:  &countingReader{r: r.Body},
+		encoding: strings.Join(codings, ", "),
+	}
+	r.Body = d
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	r.Uncompressed = true
+	return d
+}
+
+func (d *decodedBody) Read(b []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		// Codings are listed in the order they were applied.
+		var reader io.Reader = d.counter
+		for i := len(d.codings) - 1; i >= 0 && d.err == nil; i-- {
+			var closer func()
+			reader, closer, d.err = newDecoder(d.codings[i], reader)
+			if closer != nil {
+				d.closers = append(d.closers, closer)
+			}
+		}
+		d.reader = reader
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.reader.Read(b)
+}
+
+func (d *decodedBody) Close() error {
+	for _, closer := range d.closers {
+		closer()
+	}
+	d.closers = nil
+	if d.err == nil {
+		d.err = fmt.Errorf("read on closed response body")
+	}
+	return d.body.Close()
+}
+
+// newDecoder returns a reader decoding coding from r and a function releasing it.
+func newDecoder(coding string, r io.Reader) (io.Reader, func(), error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return z, func() { z.Close() }, nil
+	case "deflate":
+		// Deflate should be zlib, but some servers send raw deflate data.
+		br := bufio.NewReader(r)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			z, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, nil, err
+			}
+			return z, func() { z.Close() }, nil
+		}
+		f := flate.NewReader(br)
+		return f, func() { f.Close() }, nil
+	case "br":
+		return brotli.NewReader(r), nil, nil
+	case "zstd":
+		z := zstdDecoders.Get().(*zstd.Decoder)
+		if err := z.Reset(r); err != nil {
+			zstdDecoders.Put(z)
+			return nil, nil, err
+		}
+		return z, func() {
+			z.Reset(nil)
+			zstdDecoders.Put(z)
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported content coding %q", coding)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r  io.Reader
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.mu.Lock()
+	c.n += int64(n)
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
@@ -0,0 +1,111 @@
+package lra
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// newCompressServer answers with ReturnData compressed with the coding given in
+// the query parameter encoding and reports the Accept-Encoding of the request.
+func newCompressServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := []byte(`{"method":"` + r.Header.Get("Accept-Encoding") + `","stringdata":"` + string(bytes.Repeat([]byte("x"), 1000)) + `"}`)
+		var buf bytes.Buffer
+		var writer io.WriteCloser
+		encoding := r.URL.Query().Get("encoding")
+		switch encoding {
+		case "gzip":
+			writer = gzip.NewWriter(&buf)
+		case "deflate":
+			writer = zlib.NewWriter(&buf)
+		case "rawdeflate":
+			writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			encoding = "deflate"
+		case "br":
+			writer = brotli.NewWriter(&buf)
+		case "zstd":
+			writer, _ = zstd.NewWriter(&buf)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(payload)
+			return
+		}
+		writer.Write(payload)
+		writer.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(buf.Bytes())
+	}))
+}
+
+func TestResponseDecompression(t *testing.T) {
+	server := newCompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetResponseDecompression(true)
+	for _, encoding := range []string{"gzip", "deflate", "rawdeflate", "br", "zstd"} {
+		for i := 0; i < 2; i++ {
+			var data ReturnData
+			if err := connection.GetJSON("/data?encoding="+encoding, &data); err != nil {
+				t.Fatalf("Error getting %v response: %v", encoding, err.Error())
+			}
+			if data.Method != AcceptEncoding || len(data.StringData) != 1000 {
+				t.Errorf("Expected Accept-Encoding '%v' and 1000 bytes for %v, got '%v' and %v bytes instead.", AcceptEncoding, encoding, data.Method, len(data.StringData))
+			}
+		}
+
+		response, err := connection.GetStream("/data?encoding=" + encoding)
+		if err != nil {
+			t.Fatalf("Error streaming %v response: %v", encoding, err.Error())
+		}
+		b, err := io.ReadAll(response.Body)
+		response.Close()
+		if err != nil || len(b) < 1000 {
+			t.Errorf("Expected the decoded body for %v, got %v bytes and '%v' instead.", encoding, len(b), err)
+		}
+		expected := encoding
+		if encoding == "rawdeflate" {
+			expected = "deflate"
+		}
+		if response.ContentEncoding != expected || response.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Expected ContentEncoding %v, got '%v' instead.", expected, response.ContentEncoding)
+		}
+		if size := response.CompressedSize(); size <= 0 || size >= int64(len(b)) {
+			t.Errorf("Expected a compressed size below %v for %v, got %v instead.", len(b), encoding, size)
+		}
+	}
+}
+
+func TestResponseDecompression_SendHeaders(t *testing.T) {
+	server := newCompressServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SendHeaders = HeaderList{"accept-encoding": "gzip"}
+	var data ReturnData
+	if err := connection.GetJSON("/data?encoding=gzip", &data); err != nil {
+		t.Fatalf("Error getting gzip response: %v", err.Error())
+	}
+	if data.Method != "gzip" || len(data.StringData) != 1000 {
+		t.Errorf("Expected the decoded gzip response, got '%v' and %v bytes instead.", data.Method, len(data.StringData))
+	}
+
+	response, err := connection.GetStream("/data")
+	if err != nil {
+		t.Fatalf("Error streaming response: %v", err.Error())
+	}
+	response.Close()
+	if response.ContentEncoding != "" || response.CompressedSize() != -1 {
+		t.Errorf("Expected no encoding for an identity response, got '%v' and %v instead.", response.ContentEncoding, response.CompressedSize())
+	}
+}
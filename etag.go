@@ -0,0 +1,72 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrNoETag is returned by UpdateWithETag when the resource has no strong ETag,
+// so it can not be updated conditionally.
+var ErrNoETag = errors.New("resource has no strong ETag")
+
+// UpdateWithETag updates the JSON resource at endpoint with optimistic
+// concurrency control and returns the raw data of the update response.
+//
+// The resource is read with a GET request, bypassing caches, and decoded into a
+// new T, which is passed to mutate. The modified value is sent back with method
+// (PUT or PATCH) and the ETag of the read in the If-Match header. If the server
+// answers 412 Precondition Failed because the resource was changed in between,
+// the read-modify-write cycle is repeated up to retries times, after that the
+// *StatusError of the last attempt is returned. Errors returned by mutate abort
+// the update.
+func UpdateWithETag[T any](connection *Connection, method string, endpoint string, retries int, mutate func(value *T) error, options ...RequestOption) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		value := new(T)
+		etag, err := connection.readWithETag(endpoint, value, options...)
+		if err != nil {
+			return nil, err
+		}
+		if err := mutate(value); err != nil {
+			return nil, err
+		}
+		jsonData, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		header := http.Header{"If-Match": {etag}}
+		header = connection.defaultHeader(header, "Content-Type", "application/json")
+		response, _, err := connection.requestHeader(method, endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), header, options...)
+		var statusError *StatusError
+		if errors.As(err, &statusError) && statusError.StatusCode == http.StatusPreconditionFailed && attempt < retries {
+			continue
+		}
+		return response, err
+	}
+}
+
+// readWithETag reads the JSON resource at endpoint into value and returns its
+// strong ETag.
+func (connection *Connection) readWithETag(endpoint string, value interface{}, options ...RequestOption) (string, error) {
+	header := http.Header{"Cache-Control": {"no-cache"}}
+	header = connection.defaultHeader(header, "Accept", "application/json")
+	var x []byte
+	response, responseHeader, err := connection.requestHeader("GET", endpoint, bytes.NewReader(x), 0, header, options...)
+	if err != nil {
+		return "", err
+	}
+	etag := responseHeader.Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return "", ErrNoETag
+	}
+	if err := connection.decodeResponse(JSONCodec{}, response, responseHeader, nil, value); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
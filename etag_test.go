@@ -0,0 +1,111 @@
+package lra
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type etagDocument struct {
+	Count int `json:"count"`
+}
+
+// newETagServer serves a document at /doc whose ETag is its version. Every GET
+// of the first conflicts requests is followed by a concurrent update, so the
+// following conditional update fails. /weak has only a weak ETag.
+func newETagServer(conflicts int) (*httptest.Server, *etagDocument) {
+	var mu sync.Mutex
+	doc := new(etagDocument)
+	version := 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := `"` + strconv.Itoa(version) + `"`
+		if r.URL.Path == "/weak" {
+			etag = "W/" + etag
+		}
+		switch r.Method {
+		case "GET":
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Type", "application/json")
+			b, _ := json.Marshal(doc)
+			w.Write(b)
+			if conflicts > 0 {
+				conflicts--
+				doc.Count += 100
+				version++
+			}
+		case "PUT", "PATCH":
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			json.Unmarshal(b, doc)
+			version++
+			w.Write([]byte(`{"result":"updated"}`))
+		}
+	})), doc
+}
+
+func TestUpdateWithETag(t *testing.T) {
+	server, doc := newETagServer(2)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	calls := 0
+	b, err := UpdateWithETag(connection, "PUT", "/doc", 3, func(value *etagDocument) error {
+		calls++
+		value.Count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error updating document: %v", err.Error())
+	}
+	if string(b) != `{"result":"updated"}` {
+		t.Errorf("Expected the update response, got '%v' instead.", string(b))
+	}
+	if calls != 3 || doc.Count != 201 {
+		t.Errorf("Expected 3 attempts and count 201, got %v and %v instead.", calls, doc.Count)
+	}
+}
+
+func TestUpdateWithETag_Exhausted(t *testing.T) {
+	server, _ := newETagServer(10)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	calls := 0
+	_, err := UpdateWithETag(connection, "PATCH", "/doc", 2, func(value *etagDocument) error {
+		calls++
+		return nil
+	})
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 StatusError, got '%v' instead.", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %v instead.", calls)
+	}
+}
+
+func TestUpdateWithETag_Errors(t *testing.T) {
+	server, _ := newETagServer(0)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	_, err := UpdateWithETag(connection, "PUT", "/weak", 3, func(value *etagDocument) error { return nil })
+	if err != ErrNoETag {
+		t.Errorf("Expected ErrNoETag for a weak ETag, got '%v' instead.", err)
+	}
+	abort := errors.New("abort")
+	_, err = UpdateWithETag(connection, "PUT", "/doc", 3, func(value *etagDocument) error { return abort })
+	if err != abort {
+		t.Errorf("Expected the error of mutate, got '%v' instead.", err)
+	}
+}
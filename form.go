@@ -0,0 +1,169 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FormContentType is the media type of form encoded bodies.
+const FormContentType = "application/x-www-form-urlencoded"
+
+// EncodeForm converts data to form values. Data can be url.Values, a
+// map[string]string or a struct (or pointer to a struct).
+//
+// Struct fields are named by their `form` tag, e.g. `form:"client_id"`, or by
+// the field name if the tag is missing. Fields tagged "-" and unexported fields
+// are skipped, the option omitempty skips zero values. Fields of embedded structs
+// are added as if they were fields of the outer struct. Supported field types are
+// strings, booleans, numbers, types implementing encoding.TextMarshaler and
+// pointers and slices of those, a slice adds one value per element.
+func EncodeForm(data interface{}) (url.Values, error) {
+	switch d := data.(type) {
+	case url.Values:
+		return d, nil
+	case map[string]string:
+		values := make(url.Values)
+		for k, v := range d {
+			values.Set(k, v)
+		}
+		return values, nil
+	}
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not encode %T as form", data)
+	}
+	values := make(url.Values)
+	if err := encodeFormStruct(values, v); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeFormStruct(values url.Values, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := encodeFormStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if options == "omitempty" && fv.IsZero() {
+			continue
+		}
+		if err := encodeFormValue(values, name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeFormValue(values url.Values, name string, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		if _, ok := v.Interface().(encoding.TextMarshaler); !ok {
+			v = v.Elem()
+		}
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		values.Add(name, string(text))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		values.Add(name, v.String())
+	case reflect.Bool:
+		values.Add(name, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		values.Add(name, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		values.Add(name, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		values.Add(name, strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeFormValue(values, name, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can not encode field %s of type %s as form value", name, v.Type())
+	}
+	return nil
+}
+
+// PostForm issues a HTTP POST request with data encoded as form (see EncodeForm)
+// and returns the raw data.
+func (connection *Connection) PostForm(endpoint string, data interface{}, options ...RequestOption) ([]byte, error) {
+	return connection.requestForm("POST", endpoint, data, options...)
+}
+
+// PostFormJSON issues a HTTP POST request with data encoded as form, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PostFormJSON(endpoint string, data interface{}, result interface{}, options ...RequestOption) error {
+	return connection.requestFormJSON("POST", endpoint, data, result, options...)
+}
+
+// PutForm issues a HTTP PUT request with data encoded as form (see EncodeForm)
+// and returns the raw data.
+func (connection *Connection) PutForm(endpoint string, data interface{}, options ...RequestOption) ([]byte, error) {
+	return connection.requestForm("PUT", endpoint, data, options...)
+}
+
+// PutFormJSON issues a HTTP PUT request with data encoded as form, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PutFormJSON(endpoint string, data interface{}, result interface{}, options ...RequestOption) error {
+	return connection.requestFormJSON("PUT", endpoint, data, result, options...)
+}
+
+func (connection *Connection) requestForm(method string, endpoint string, data interface{}, options ...RequestOption) ([]byte, error) {
+	values, err := EncodeForm(data)
+	if err != nil {
+		return nil, err
+	}
+	body := values.Encode()
+	return connection.requestReader(method, endpoint, strings.NewReader(body), int64(len(body)), http.Header{"Content-Type": {FormContentType}}, options...)
+}
+
+func (connection *Connection) requestFormJSON(method string, endpoint string, data interface{}, result interface{}, options ...RequestOption) error {
+	values, err := EncodeForm(data)
+	if err != nil {
+		return err
+	}
+	body := values.Encode()
+	return connection.requestJSON(method, endpoint, strings.NewReader(body), int64(len(body)), http.Header{"Content-Type": {FormContentType}}, result, options...)
+}
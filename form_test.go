@@ -0,0 +1,87 @@
+package lra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type formCredentials struct {
+	ClientID string `form:"client_id"`
+	Secret   string `form:"client_secret,omitempty"`
+}
+
+type formRequest struct {
+	formCredentials
+	GrantType string    `form:"grant_type"`
+	Scopes    []string  `form:"scope"`
+	Limit     int       `form:"limit,omitempty"`
+	Verbose   bool      `form:"verbose"`
+	Ratio     *float64  `form:"ratio"`
+	Since     time.Time `form:"since,omitempty"`
+	Internal  string    `form:"-"`
+	Plain     string
+	hidden    string
+}
+
+func TestEncodeForm(t *testing.T) {
+	ratio := 0.5
+	values, err := EncodeForm(&formRequest{
+		formCredentials: formCredentials{ClientID: "lra"},
+		GrantType:       "client_credentials",
+		Scopes:          []string{"read", "write"},
+		Verbose:         true,
+		Ratio:           &ratio,
+		Internal:        "internal",
+		Plain:           "plain",
+		hidden:          "hidden",
+	})
+	if err != nil {
+		t.Fatalf("Error encoding form: %v", err.Error())
+	}
+	expected := "Plain=plain&client_id=lra&grant_type=client_credentials&ratio=0.5&scope=read&scope=write&verbose=true"
+	if values.Encode() != expected {
+		t.Errorf("Expected '%v', got '%v' instead.", expected, values.Encode())
+	}
+
+	if _, err := EncodeForm([]string{"a"}); err == nil {
+		t.Errorf("Expected an error for a slice, got nil")
+	}
+	if _, err := EncodeForm(struct{ C chan int }{}); err == nil {
+		t.Errorf("Expected an error for a channel field, got nil")
+	}
+}
+
+func TestPostForm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != FormContentType || r.Header.Get("Test-Header") != "test" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		r.ParseForm()
+		w.Write([]byte(`{"method":"` + r.Method + `","stringdata":"` + r.PostForm.Get("grant_type") + `"}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, method := range []string{"POST", "PUT"} {
+		var data ReturnData
+		var err error
+		if method == "POST" {
+			err = connection.PostFormJSON("/token", url.Values{"grant_type": {"password"}}, &data)
+		} else {
+			err = connection.PutFormJSON("/token", map[string]string{"grant_type": "password"}, &data)
+		}
+		if err != nil {
+			t.Fatalf("Error sending form: %v", err.Error())
+		}
+		if data.Method != method || data.StringData != "password" {
+			t.Errorf("Expected %v with grant_type 'password', got %v and '%v' instead.", method, data.Method, data.StringData)
+		}
+	}
+	if _, ok := connection.SendHeaders["Content-Type"]; ok {
+		t.Errorf("Expected SendHeaders without Content-Type, got '%v' instead.", connection.SendHeaders["Content-Type"])
+	}
+}
@@ -3,6 +3,23 @@ module github.com/joernott/lra
 go 1.25.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/coder/websocket v1.8.14
+	github.com/fxamacker/cbor/v2 v2.9.2
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/klauspost/compress v1.18.0
+	github.com/quic-go/quic-go v0.59.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	go.yaml.in/yaml/v3 v3.0.4
 	golang.org/x/net v0.53.0
+	golang.org/x/text v0.36.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/quic-go/qpack v0.6.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/crypto v0.50.0 // indirect
+	golang.org/x/sys v0.43.0 // indirect
 )
@@ -0,0 +1,259 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HealthState is the health of a node as seen by the HealthChecker.
+type HealthState int
+
+const (
+	// HealthUnknown is the state of a node before the first check completed.
+	HealthUnknown HealthState = iota
+	// HealthUp marks a node which answered the health endpoint successfully.
+	HealthUp
+	// HealthDown marks a node which failed the health endpoint.
+	HealthDown
+)
+
+// String returns a human readable name for the state.
+func (state HealthState) String() string {
+	switch state {
+	case HealthUp:
+		return "up"
+	case HealthDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthCheck configures the background health checker of a Connection.
+//
+// Endpoint is requested with GET relative to the BaseURL of the connection, e.g.
+// "/_cluster/health". Interval is the time between two checks (default 10s) and
+// Timeout limits a single check independently of the connection timeout
+// (default 5s). HealthyThreshold and UnhealthyThreshold are the number of
+// consecutive successes or failures needed before a node changes its state
+// (default 1). OnChange, if set, is called after every state transition with the
+// previous state and the new status of the node. It runs on the goroutine of the
+// checker and must not call Stop or Close of the connection, which wait for that
+// goroutine to finish.
+type HealthCheck struct {
+	Endpoint           string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	OnChange           func(previous HealthState, status NodeStatus)
+}
+
+// NodeStatus is a snapshot of the health of a single node.
+type NodeStatus struct {
+	Node                 string
+	State                HealthState
+	Since                time.Time
+	LastCheck            time.Time
+	LastError            error
+	Latency              time.Duration
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+}
+
+// HealthChecker periodically checks the server of a Connection in the background.
+// It is created by StartHealthCheck and stopped by Stop or by closing the Connection.
+type HealthChecker struct {
+	connection *Connection
+	config     HealthCheck
+	mu         sync.Mutex
+	status     NodeStatus
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// ErrHealthCheckRunning is returned when a second health checker is started on a Connection.
+var ErrHealthCheckRunning = errors.New("health check already running")
+
+// StartHealthCheck starts a background health checker for the connection. The
+// first check is run immediately, subsequent checks every Interval until Stop or
+// Close is called.
+func (connection *Connection) StartHealthCheck(config HealthCheck) (*HealthChecker, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("health check endpoint must not be empty")
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second * 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 5
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = 1
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = 1
+	}
+
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if connection.health != nil {
+		return nil, ErrHealthCheckRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	checker := &HealthChecker{
+		connection: connection,
+		config:     config,
+		status:     NodeStatus{Node: connection.node(), State: HealthUnknown, Since: time.Now()},
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	connection.health = checker
+	go checker.run(ctx)
+	return checker, nil
+}
+
+// Status returns a snapshot of the health of the server of the connection, keyed
+// by its node name "server:port".
+func (checker *HealthChecker) Status() map[string]NodeStatus {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	return map[string]NodeStatus{checker.status.Node: checker.status}
+}
+
+// Stop stops the health checker and waits for a running check to finish.
+// It is safe to call Stop more than once, but not from the OnChange callback.
+func (checker *HealthChecker) Stop() {
+	checker.cancel()
+	<-checker.done
+
+	connection := checker.connection
+	connection.mu.Lock()
+	if connection.health == checker {
+		connection.health = nil
+	}
+	connection.mu.Unlock()
+}
+
+// Close stops background activity like the health checker, closes idle
+// connections of the http client and closes the HTTP/3 transports, including the
+// ones replaced by SetTransportOptions. The Connection must not be used afterwards.
+func (connection *Connection) Close() error {
+	connection.mu.Lock()
+	checker := connection.health
+	retired := connection.retired
+	connection.retired = nil
+	connection.mu.Unlock()
+	if checker != nil {
+		checker.Stop()
+	}
+	var err error
+	for _, closer := range retired {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	client := connection.httpClient()
+	client.CloseIdleConnections()
+	if closer, ok := client.Transport.(io.Closer); ok {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// node returns the name under which the server of the connection is tracked.
+func (connection *Connection) node() string {
+	return connection.Server + ":" + strconv.Itoa(connection.Port)
+}
+
+func (checker *HealthChecker) run(ctx context.Context) {
+	defer close(checker.done)
+
+	ticker := time.NewTicker(checker.config.Interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := checker.check(ctx)
+		if ctx.Err() != nil {
+			// The checker is stopping, a cancelled check says nothing about the node.
+			return
+		}
+		checker.record(start, time.Since(start), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (checker *HealthChecker) check(ctx context.Context) error {
+	connection := checker.connection
+	req, err := http.NewRequestWithContext(ctx, "GET", connection.BaseURL+checker.config.Endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for h, v := range connection.SendHeaders {
+		req.Header.Set(h, v)
+	}
+	// The transport is looked up for every check, it may be replaced by
+	// SetTransportOptions.
+	client := &http.Client{
+		Transport: connection.httpClient().Transport,
+		Timeout:   checker.config.Timeout,
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	io.Copy(io.Discard, r.Body)
+	if r.StatusCode > 399 {
+		return newStatusError(r, nil)
+	}
+	return nil
+}
+
+func (checker *HealthChecker) record(start time.Time, latency time.Duration, err error) {
+	checker.mu.Lock()
+	node := &checker.status
+	previous := node.State
+	node.LastCheck = start
+	node.LastError = err
+	node.Latency = latency
+	if err == nil {
+		node.ConsecutiveSuccesses++
+		node.ConsecutiveFailures = 0
+		if node.State != HealthUp && node.ConsecutiveSuccesses >= checker.config.HealthyThreshold {
+			node.State = HealthUp
+		}
+	} else {
+		node.ConsecutiveFailures++
+		node.ConsecutiveSuccesses = 0
+		if node.State != HealthDown && node.ConsecutiveFailures >= checker.config.UnhealthyThreshold {
+			node.State = HealthDown
+		}
+	}
+	changed := node.State != previous
+	if changed {
+		node.Since = start
+	}
+	status := *node
+	checker.mu.Unlock()
+
+	if changed && checker.config.OnChange != nil {
+		checker.config.OnChange(previous, status)
+	}
+}
@@ -0,0 +1,119 @@
+package lra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck_Transitions(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cluster/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Test-Header") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"green"}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var mu sync.Mutex
+	var transitions []HealthState
+	changed := make(chan struct{}, 10)
+	checker, err := connection.StartHealthCheck(HealthCheck{
+		Endpoint: "/_cluster/health",
+		Interval: time.Millisecond * 10,
+		Timeout:  time.Second,
+		OnChange: func(previous HealthState, status NodeStatus) {
+			mu.Lock()
+			transitions = append(transitions, status.State)
+			mu.Unlock()
+			changed <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error starting health check: %v", err.Error())
+	}
+	_, err = connection.StartHealthCheck(HealthCheck{Endpoint: "/_cluster/health"})
+	if err != ErrHealthCheckRunning {
+		t.Errorf("Expected ErrHealthCheckRunning, got '%v' instead.", err)
+	}
+
+	waitForChange(t, changed)
+	status := checker.Status()[connection.node()]
+	if status.State != HealthUp {
+		t.Errorf("Expected state up, got '%v' instead.", status.State)
+	}
+
+	healthy.Store(false)
+	waitForChange(t, changed)
+	status = checker.Status()[connection.node()]
+	if status.State != HealthDown {
+		t.Errorf("Expected state down, got '%v' instead.", status.State)
+	}
+	if status.LastError == nil || status.LastError.Error() != "503 Service Unavailable" {
+		t.Errorf("Expected last error '503 Service Unavailable', got '%v' instead.", status.LastError)
+	}
+
+	connection.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transitions) != 2 || transitions[0] != HealthUp || transitions[1] != HealthDown {
+		t.Errorf("Expected transitions [up down], got '%v' instead.", transitions)
+	}
+	if _, err := connection.StartHealthCheck(HealthCheck{Endpoint: "/_cluster/health"}); err != nil {
+		t.Errorf("Expected health check to restart after Close, got '%v' instead.", err)
+	}
+	connection.Close()
+}
+
+func TestHealthCheck_Threshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	defer connection.Close()
+	changed := make(chan struct{}, 10)
+	checker, err := connection.StartHealthCheck(HealthCheck{
+		Endpoint:           "/health",
+		Interval:           time.Millisecond * 10,
+		UnhealthyThreshold: 3,
+		OnChange: func(previous HealthState, status NodeStatus) {
+			changed <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error starting health check: %v", err.Error())
+	}
+	waitForChange(t, changed)
+	status := checker.Status()[connection.node()]
+	if status.State != HealthDown {
+		t.Errorf("Expected state down, got '%v' instead.", status.State)
+	}
+	if status.ConsecutiveFailures != 3 {
+		t.Errorf("Expected 3 consecutive failures, got %v instead.", status.ConsecutiveFailures)
+	}
+}
+
+func waitForChange(t *testing.T, changed chan struct{}) {
+	select {
+	case <-changed:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timed out waiting for health state change")
+	}
+}
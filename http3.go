@@ -0,0 +1,105 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// errHTTP3Proxy is returned when HTTP/3 is combined with a proxy.
+var errHTTP3Proxy = errors.New("HTTP/3 can not be used through a proxy")
+
+// fallbackTransport sends https requests via HTTP/3 and falls back to the
+// regular transport when the HTTP/3 request fails before a response arrived.
+type fallbackTransport struct {
+	h3       *http3.Transport
+	fallback *http.Transport
+	backoff  time.Duration
+
+	mu          sync.Mutex
+	failedUntil time.Time
+}
+
+// newHTTP3Transport wraps tr in a transport trying HTTP/3 first. The QUIC
+// connections use the TLS settings of tr and the timeouts from options.
+func newHTTP3Transport(tr *http.Transport, options TransportOptions) *fallbackTransport {
+	var tlsConfig *tls.Config
+	if tr.TLSClientConfig != nil {
+		tlsConfig = tr.TLSClientConfig.Clone()
+	}
+	backoff := options.HTTP3Backoff
+	if backoff <= 0 {
+		backoff = time.Minute * 5
+	}
+	handshakeTimeout := options.TLSHandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = options.DialTimeout
+	}
+	return &fallbackTransport{
+		h3: &http3.Transport{
+			TLSClientConfig: tlsConfig,
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: handshakeTimeout,
+				MaxIdleTimeout:       options.IdleConnTimeout,
+				KeepAlivePeriod:      options.KeepAlive,
+			},
+		},
+		fallback: tr,
+		backoff:  backoff,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// HTTP/3 has no upgrade mechanism, WebSocket handshakes need HTTP/1.1.
+	if req.URL.Scheme != "https" || req.Header.Get("Upgrade") != "" || !t.useHTTP3() {
+		return t.fallback.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body could not be sent a second time, so there is no fallback.
+		return t.h3.RoundTrip(req)
+	}
+	r, err := t.h3.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return r, err
+	}
+	t.mu.Lock()
+	t.failedUntil = time.Now().Add(t.backoff)
+	t.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.fallback.RoundTrip(retry)
+}
+
+func (t *fallbackTransport) useHTTP3() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().After(t.failedUntil)
+}
+
+// CloseIdleConnections closes the idle connections of both transports.
+func (t *fallbackTransport) CloseIdleConnections() {
+	t.h3.CloseIdleConnections()
+	t.fallback.CloseIdleConnections()
+}
+
+// Close closes all QUIC connections and the UDP socket.
+func (t *fallbackTransport) Close() error {
+	t.fallback.CloseIdleConnections()
+	return t.h3.Close()
+}
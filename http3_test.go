@@ -0,0 +1,122 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func newProtoServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"proto":"` + r.Proto + `","header":"` + r.Header.Get("Test-Header") + `"}`))
+	}))
+}
+
+func newHTTP3Connection(t *testing.T, server *httptest.Server) *Connection {
+	connection := newTestConnection(t, server)
+	options := DefaultTransportOptions()
+	options.HTTP3 = true
+	options.TLSHandshakeTimeout = time.Second
+	if err := connection.SetTransportOptions(options); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	return connection
+}
+
+func TestHTTP3_OK(t *testing.T) {
+	server := newProtoServer()
+	defer server.Close()
+	udp, err := net.ListenPacket("udp", server.Listener.Addr().String())
+	if err != nil {
+		t.Skipf("Could not listen on UDP port of the test server: %v", err.Error())
+	}
+	h3server := &http3.Server{
+		Handler:   server.Config.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(server.TLS),
+	}
+	go h3server.Serve(udp)
+	defer h3server.Close()
+
+	connection := newHTTP3Connection(t, server)
+	defer connection.Close()
+	data := make(map[string]interface{})
+	if err := connection.PostJSON("/", indata, &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["proto"] != "HTTP/3.0" {
+		t.Errorf("Expected HTTP/3.0, got '%v' instead.", data["proto"])
+	}
+	if data["header"] != "test" {
+		t.Errorf("Expected Test-Header 'test', got '%v' instead.", data["header"])
+	}
+}
+
+func TestHTTP3_Fallback(t *testing.T) {
+	server := newProtoServer()
+	defer server.Close()
+
+	connection := newHTTP3Connection(t, server)
+	defer connection.Close()
+	data := make(map[string]interface{})
+	if err := connection.PostJSON("/", indata, &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["proto"] != "HTTP/1.1" {
+		t.Errorf("Expected fallback to HTTP/1.1, got '%v' instead.", data["proto"])
+	}
+	start := time.Now()
+	if err := connection.GetJSON("/", &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Errorf("Expected HTTP/3 to be skipped after a failure, request took %v.", elapsed)
+	}
+}
+
+func TestHTTP3_Proxy(t *testing.T) {
+	connection, err := NewConnection(true, "localhost", 443, "", "", "", false, "http://proxy.example.com:3128", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	options := DefaultTransportOptions()
+	options.HTTP3 = true
+	if err := connection.SetTransportOptions(options); err != errHTTP3Proxy {
+		t.Errorf("Expected errHTTP3Proxy, got '%v' instead.", err)
+	}
+	if _, ok := connection.Client.Transport.(*http.Transport); !ok {
+		t.Errorf("Expected transport to be unchanged, got %T instead.", connection.Client.Transport)
+	}
+}
+
+func TestHTTP3_CloseReplaced(t *testing.T) {
+	connection, err := NewConnection(true, "localhost", 443, "", "", "", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	options := DefaultTransportOptions()
+	options.HTTP3 = true
+	if err := connection.SetTransportOptions(options); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	tr := connection.Client.Transport.(*fallbackTransport)
+	if err := connection.SetTransportOptions(DefaultTransportOptions()); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://localhost/", nil)
+	if _, err := tr.h3.RoundTrip(req); errors.Is(err, http3.ErrTransportClosed) {
+		t.Errorf("Expected the replaced HTTP/3 transport to stay usable, got '%v' instead.", err)
+	}
+	connection.Close()
+	if _, err := tr.h3.RoundTrip(req); !errors.Is(err, http3.ErrTransportClosed) {
+		t.Errorf("Expected the HTTP/3 transport to be closed, got '%v' instead.", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DecodeJSONArray returns an iterator over the elements of a JSON array read from
+// r. Pointer is a JSON pointer (RFC 6901) addressing the array inside of the
+// document, e.g. "/hits/hits", an empty pointer addresses the top level array.
+//
+// The document is read token by token, so only the current element is held in
+// memory. Values before the array are skipped without decoding them, the rest of
+// the document after the array is not read. The iteration stops after the first
+// error, which is yielded together with the zero value of T.
+func DecodeJSONArray[T any](r io.Reader, pointer string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		decoder := json.NewDecoder(r)
+		if err := seekJSONPointer(decoder, pointer); err != nil {
+			yield(zero, err)
+			return
+		}
+		token, err := decoder.Token()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if token != json.Delim('[') {
+			yield(zero, fmt.Errorf("json pointer %q does not address an array", pointer))
+			return
+		}
+		for decoder.More() {
+			var v T
+			if err := decoder.Decode(&v); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// GetJSONArray issues a HTTP GET request and returns an iterator over the elements
+// of the array addressed by pointer in the response, see DecodeJSONArray. Errors
+// of the request are yielded as the first element. The response is closed when
+// the iteration ends.
+func GetJSONArray[T any](connection *Connection, endpoint string, pointer string, options ...RequestOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		response, err := connection.stream(context.Background(), "GET", endpoint, nil, 0, http.Header{"Accept": {"application/json"}}, options...)
+		if err != nil {
+			var v T
+			yield(v, err)
+			return
+		}
+		defer response.Close()
+		for v, err := range DecodeJSONArray[T](response.Body, pointer) {
+			if !yield(v, err) {
+				return
+			}
+		}
+	}
+}
+
+// seekJSONPointer advances decoder to the value addressed by pointer, so the
+// next token read is the first token of that value.
+func seekJSONPointer(decoder *json.Decoder, pointer string) error {
+	if pointer == "" {
+		return nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return fmt.Errorf("invalid json pointer %q", pointer)
+	}
+	for _, reference := range strings.Split(pointer[1:], "/") {
+		reference = strings.ReplaceAll(strings.ReplaceAll(reference, "~1", "/"), "~0", "~")
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'):
+			err = seekJSONKey(decoder, reference)
+		case json.Delim('['):
+			err = seekJSONIndex(decoder, reference)
+		default:
+			err = io.EOF
+		}
+		if err == io.EOF {
+			return fmt.Errorf("json pointer %q not found", pointer)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seekJSONKey skips the members of an object until the member named key.
+func seekJSONKey(decoder *json.Decoder, key string) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		if err := skipJSONValue(decoder); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// seekJSONIndex skips the elements of an array until the element at reference.
+func seekJSONIndex(decoder *json.Decoder, reference string) error {
+	index, err := strconv.Atoi(reference)
+	if err != nil || index < 0 {
+		return io.EOF
+	}
+	for i := 0; decoder.More(); i++ {
+		if i == index {
+			return nil
+		}
+		if err := skipJSONValue(decoder); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// skipJSONValue reads the next value token by token without keeping it.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
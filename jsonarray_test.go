@@ -0,0 +1,108 @@
+package lra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type endlessArray struct {
+	started bool
+}
+
+func (r *endlessArray) Read(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		return copy(p, `{"data":[`), nil
+	}
+	return copy(p, `{"id":1},`), nil
+}
+
+func collectIDs(t *testing.T, r io.Reader, pointer string) []int {
+	var ids []int
+	for item, err := range DecodeJSONArray[ndjsonItem](r, pointer) {
+		if err != nil {
+			t.Fatalf("Error decoding %v: %v", pointer, err.Error())
+		}
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestDecodeJSONArray(t *testing.T) {
+	if ids := collectIDs(t, strings.NewReader(`[{"id":1},{"id":2}]`), ""); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("Expected ids [1 2], got %v instead.", ids)
+	}
+
+	doc := `{"took":5,"shards":{"ok":[1,2,{"x":[]}]},"hits":{"total":2,"hits":[{"id":3},{"id":4}]},"a/b":[{"id":5}],"rest":[1]}`
+	if ids := collectIDs(t, strings.NewReader(doc), "/hits/hits"); !slices.Equal(ids, []int{3, 4}) {
+		t.Errorf("Expected ids [3 4], got %v instead.", ids)
+	}
+	if ids := collectIDs(t, strings.NewReader(doc), "/a~1b"); !slices.Equal(ids, []int{5}) {
+		t.Errorf("Expected ids [5], got %v instead.", ids)
+	}
+	nested := `{"pages":[{"items":[{"id":6}]},{"items":[{"id":7},{"id":8}]}]}`
+	if ids := collectIDs(t, strings.NewReader(nested), "/pages/1/items"); !slices.Equal(ids, []int{7, 8}) {
+		t.Errorf("Expected ids [7 8], got %v instead.", ids)
+	}
+}
+
+func TestDecodeJSONArray_Errors(t *testing.T) {
+	tests := map[string]string{
+		"/missing":    `json pointer "/missing" not found`,
+		"/took":       `json pointer "/took" does not address an array`,
+		"/took/x":     `json pointer "/took/x" not found`,
+		"/hits/5":     `json pointer "/hits/5" not found`,
+		"no-slash":    `invalid json pointer "no-slash"`,
+		"/hits/hits2": `json pointer "/hits/hits2" not found`,
+	}
+	doc := `{"took":5,"hits":[{"id":1}]}`
+	for pointer, expected := range tests {
+		var err error
+		for _, e := range DecodeJSONArray[ndjsonItem](strings.NewReader(doc), pointer) {
+			err = e
+		}
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error '%v', got '%v' instead.", expected, err)
+		}
+	}
+}
+
+func TestDecodeJSONArray_Lazy(t *testing.T) {
+	count := 0
+	for item, err := range DecodeJSONArray[ndjsonItem](&endlessArray{}, "/data") {
+		if err != nil || item.ID != 1 {
+			t.Fatalf("Expected item 1, got %v and '%v' instead.", item, err)
+		}
+		count++
+		if count == 1000 {
+			break
+		}
+	}
+	if count != 1000 {
+		t.Errorf("Expected 1000 items, got %v instead.", count)
+	}
+}
+
+func TestGetJSONArray(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hits":{"hits":[{"id":1},{"id":2},{"id":3}]}}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var ids []int
+	for item, err := range GetJSONArray[ndjsonItem](connection, "/_search", "/hits/hits") {
+		if err != nil {
+			t.Fatalf("Error decoding: %v", err.Error())
+		}
+		ids = append(ids, item.ID)
+	}
+	if !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Errorf("Expected ids [1 2 3], got %v instead.", ids)
+	}
+}
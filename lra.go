@@ -11,16 +11,14 @@ package lra
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
-	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strconv"
+	"sync"
 	"time"
-
-	"golang.org/x/net/proxy"
 )
 
 // HeaderList is a key-value list of headers to set on every request. Used when declaring the connection.
@@ -32,6 +30,7 @@ type HeaderList map[string]string
 //
 // The fields are mostly set by the parameters passed to the NewConnection function
 // except for Protocol, BaseURL and Client which are constructed based on those informations.
+// TransportOptions are set to DefaultTransportOptions.
 type Connection struct {
 	Protocol     string
 	Server       string
@@ -46,6 +45,28 @@ type Connection struct {
 	SendHeaders  HeaderList
 	Client       *http.Client
 	Timeout      time.Duration
+
+	// TransportOptions are the options the transport of Client was built with.
+	// Use SetTransportOptions to change them.
+	TransportOptions TransportOptions
+
+	mu         sync.Mutex
+	health     *HealthChecker
+	breakers   map[string]*CircuitBreaker
+	limiters   []rateLimitRule
+	bulkhead   *Bulkhead
+	priorities []priorityRule
+	codecs     map[string]Codec
+	codec      Codec
+
+	compression          string
+	compressionThreshold int
+	decompression        bool
+	cache                *HTTPCache
+
+	// retired are transports replaced by SetTransportOptions, which are
+	// closed by Close.
+	retired []io.Closer
 }
 
 // NewConnection builds a Connection object with a configured http client.
@@ -62,40 +83,12 @@ type Connection struct {
 // authentication headers, content type definitions etc.
 func NewConnection(UseSSL bool, Server string, Port int, BaseEndpoint string, User string, Password string, ValidateSSL bool, Proxy string, ProxyIsSocks bool, SendHeaders HeaderList, Timeout time.Duration) (*Connection, error) {
 	var connection *Connection
-	var tr *http.Transport
 
 	if Timeout == time.Second*0 {
 		Timeout = time.Second * 60
 	}
 
 	connection = new(Connection)
-	tr = &http.Transport{
-		DisableKeepAlives:   false,
-		IdleConnTimeout:     0,
-		MaxIdleConns:        200,
-		MaxIdleConnsPerHost: 100,
-	}
-	if !ValidateSSL {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
-	if Proxy != "" {
-		if ProxyIsSocks {
-			dialer, err := proxy.SOCKS5("tcp", Proxy, nil, proxy.Direct)
-			if err != nil {
-				return nil, err
-			}
-			tr.Dial = dialer.Dial
-		} else {
-			proxyURL, err := url.Parse(Proxy)
-			if err != nil {
-				return nil, err
-			}
-			tr.Proxy = http.ProxyURL(proxyURL)
-		}
-	}
-	connection.Client = &http.Client{
-		Transport: tr,
-		Timeout:   Timeout}
 	if UseSSL {
 		connection.Protocol = "https"
 	} else {
@@ -116,79 +109,188 @@ func NewConnection(UseSSL bool, Server string, Port int, BaseEndpoint string, Us
 	}
 	connection.BaseURL = connection.BaseURL + Server + ":" + strconv.Itoa(Port) + BaseEndpoint
 	connection.Timeout = Timeout
+	connection.TransportOptions = DefaultTransportOptions()
+	tr, err := connection.newTransport(connection.TransportOptions)
+	if err != nil {
+		return nil, err
+	}
+	connection.Client = &http.Client{
+		Transport: tr,
+		Timeout:   Timeout}
 	return connection, nil
 }
 
-func (connection *Connection) request(method string, endpoint string, jsonData []byte) ([]byte, error) {
-	var req *http.Request
-	var err error
-	var err2 error
-	var response []byte
+func (connection *Connection) request(method string, endpoint string, jsonData []byte, options ...RequestOption) ([]byte, error) {
+	return connection.requestReader(method, endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, options...)
+}
 
-	target := connection.BaseURL + endpoint
-	switch method {
-	case "CONNECT", "GET", "HEAD", "OPTIONS":
-		req, err = http.NewRequest(method, target, nil)
-	default:
-		req, err = http.NewRequest(method, target, bytes.NewBuffer(jsonData))
-	}
+// requestReader sends a request with the body read from body and returns the read
+// response. Header is added to the headers of the connection for this request.
+func (connection *Connection) requestReader(method string, endpoint string, body io.Reader, length int64, header http.Header, options ...RequestOption) ([]byte, error) {
+	response, _, err := connection.requestHeader(method, endpoint, body, length, header, options...)
+	return response, err
+}
 
+// requestHeader works like requestReader and also returns the response headers.
+func (connection *Connection) requestHeader(method string, endpoint string, body io.Reader, length int64, header http.Header, options ...RequestOption) ([]byte, http.Header, error) {
+	o := newRequestOptions(options)
+	req, err := connection.newRequest(context.Background(), method, endpoint, body, length, header, o)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	for h, v := range connection.SendHeaders {
-		req.Header.Set(h, v)
+	response, r, err := connection.readResponse(o.client(connection.httpClient()), req, endpoint)
+	if r == nil {
+		return nil, nil, err
 	}
+	return response, r.Header, err
+}
 
-	r, err := connection.Client.Do(req)
+// readResponse sends req and reads the response. HEAD requests return the response
+// headers as JSON. For status codes above 399, a *StatusError is returned together
+// with the data and the response.
+func (connection *Connection) readResponse(client *http.Client, req *http.Request, endpoint string) ([]byte, *http.Response, error) {
+	var err2 error
+	var response []byte
+
+	r, err := connection.do(client, req, endpoint)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	decompressResponse(r)
 	defer r.Body.Close()
 
-	if method != "HEAD" {
+	if req.Method != "HEAD" {
 		response, err2 = ioutil.ReadAll(r.Body)
 	} else {
 		response, err2 = json.Marshal(r.Header)
 	}
 	if err2 != nil {
-		return nil, err2
+		return nil, nil, err2
 	}
 	if r.StatusCode > 399 {
-		return response, errors.New(r.Status)
+		return response, r, newStatusError(r, response)
 	}
-	return response, nil
+	return response, r, nil
 }
 
-// Connect issues a HTTP CONNECT request and returns the raw data.
-func (connection *Connection) Connect(endpoint string) ([]byte, error) {
-	var x []byte
-	return connection.request("CONNECT", endpoint, x)
+// newRequest builds a request to endpoint with the headers of the connection,
+// header and the request options o, which may be nil. The body is only sent for
+// methods which take one, see setBody for length. It is compressed if
+// SetRequestCompression applies to it. Endpoint is expanded first if the request
+// has a WithTemplate option.
+func (connection *Connection) newRequest(ctx context.Context, method string, endpoint string, body io.Reader, length int64, header http.Header, o *requestOptions) (*http.Request, error) {
+	endpoint, err := o.endpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target := connection.BaseURL + endpoint
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	encoding := ""
+	switch method {
+	case "CONNECT", "GET", "HEAD", "OPTIONS":
+	default:
+		if body != nil {
+			encoding = connection.requestCompression(length, header, o)
+		}
+		if encoding != "" {
+			setCompressedBody(req, encoding, body, length)
+		} else {
+			setBody(req, body, length)
+		}
+	}
+	for h, v := range connection.SendHeaders {
+		req.Header.Set(h, v)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if acceptEncoding := connection.acceptEncoding(); acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	for h, v := range header {
+		req.Header[h] = v
+	}
+	if o != nil {
+		o.apply(req)
+	}
+	return req, nil
 }
 
-// ConnectJSON issues a HTTP Connect request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) ConnectJSON(endpoint string, data interface{}) error {
-	var x []byte
+// do sends a prepared request for endpoint through the cache, the rate limiters,
+// the bulkhead and the circuit breaker of the connection. A bulkhead slot is held
+// until the body of the returned response is closed.
+func (connection *Connection) do(client *http.Client, req *http.Request, endpoint string) (*http.Response, error) {
+	if cache := connection.Cache(); cache != nil {
+		return cache.do(req, func(req *http.Request) (*http.Response, error) {
+			return connection.send(client, req, endpoint)
+		})
+	}
+	return connection.send(client, req, endpoint)
+}
 
-	response, err := connection.request("CONNECT", endpoint, x)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
+// send sends req after the rate limiters, the bulkhead and the circuit breaker
+// admitted it, see do.
+func (connection *Connection) send(client *http.Client, req *http.Request, endpoint string) (*http.Response, error) {
+	limiters := connection.RateLimiters(req.Method, endpoint)
+	for _, limiter := range limiters {
+		if err := limiter.Wait(req.Context()); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+	}
+
+	release := func() {}
+	if bulkhead := connection.Bulkhead(); bulkhead != nil {
+		var err error
+		release, err = bulkhead.Acquire(req.Context(), connection.Priority(req.Method, endpoint))
 		if err != nil {
-			return err
+			closeBody(req)
+			return nil, err
 		}
-		return err2
 	}
-	return err
+
+	breaker := connection.CircuitBreaker(endpoint)
+	var generation uint64
+	if breaker != nil {
+		var err error
+		generation, err = breaker.allow()
+		if err != nil {
+			release()
+			closeBody(req)
+			return nil, err
+		}
+	}
+	r, err := client.Do(req)
+	if breaker != nil {
+		breaker.record(generation, r, err)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	r.Body = &releaseBody{ReadCloser: r.Body, release: release}
+	for _, limiter := range limiters {
+		if limiter.Adaptive {
+			limiter.update(r)
+		}
+	}
+	return r, nil
 }
 
-// Delete issues a HTTP DELETE request and returns the raw data.
-func (connection *Connection) Delete(endpoint string, jsonData []byte) ([]byte, error) {
-	return connection.request("DELETE", endpoint, jsonData)
+// closeBody closes the body of a request which is not sent, like the transport
+// does for requests it sends.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
 }
 
-// DeleteJSON issues a HTTP DELETE request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) DeleteJSON(endpoint string, jsonData []byte, data interface{}) error {
-	response, err := connection.request("DELETE", endpoint, jsonData)
+// unmarshalResponse parses the response as JSON into data. The error of the request
+// takes precedence over parse errors.
+func unmarshalResponse(response []byte, err error, data interface{}) error {
 	err2 := json.Unmarshal(response, data)
 	if err2 != nil {
 		if err != nil {
@@ -199,140 +301,103 @@ func (connection *Connection) DeleteJSON(endpoint string, jsonData []byte, data
 	return err
 }
 
+// Connect issues a HTTP CONNECT request and returns the raw data. To open a
+// tunnel through the server, use Tunnel instead.
+func (connection *Connection) Connect(endpoint string, options ...RequestOption) ([]byte, error) {
+	var x []byte
+	return connection.request("CONNECT", endpoint, x, options...)
+}
+
+// ConnectJSON issues a HTTP Connect request, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) ConnectJSON(endpoint string, data interface{}, options ...RequestOption) error {
+	var x []byte
+	return connection.requestJSON("CONNECT", endpoint, bytes.NewReader(x), 0, nil, data, options...)
+}
+
+// Delete issues a HTTP DELETE request and returns the raw data.
+func (connection *Connection) Delete(endpoint string, jsonData []byte, options ...RequestOption) ([]byte, error) {
+	return connection.request("DELETE", endpoint, jsonData, options...)
+}
+
+// DeleteJSON issues a HTTP DELETE request, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) DeleteJSON(endpoint string, jsonData []byte, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("DELETE", endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, data, options...)
+}
+
 // Get issues a HTTP GET request and returns the raw data.
-func (connection *Connection) Get(endpoint string) ([]byte, error) {
+func (connection *Connection) Get(endpoint string, options ...RequestOption) ([]byte, error) {
 	var x []byte
-	return connection.request("GET", endpoint, x)
+	return connection.request("GET", endpoint, x, options...)
 }
 
 // GetJSON issues a HTTP GET request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) GetJSON(endpoint string, data interface{}) error {
+func (connection *Connection) GetJSON(endpoint string, data interface{}, options ...RequestOption) error {
 	var x []byte
-
-	response, err := connection.request("GET", endpoint, x)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+	return connection.requestJSON("GET", endpoint, bytes.NewReader(x), 0, nil, data, options...)
 }
 
 // Head issues a HTTP HEAD request and returns the raw data.
-func (connection *Connection) Head(endpoint string) ([]byte, error) {
+func (connection *Connection) Head(endpoint string, options ...RequestOption) ([]byte, error) {
 	var x []byte
-	return connection.request("HEAD", endpoint, x)
+	return connection.request("HEAD", endpoint, x, options...)
 }
 
 // HeadJSON issues a HTTP HEAD request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) HeadJSON(endpoint string, data interface{}) error {
+func (connection *Connection) HeadJSON(endpoint string, data interface{}, options ...RequestOption) error {
 	var x []byte
-
-	response, err := connection.request("HEAD", endpoint, x)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+	return connection.requestJSON("HEAD", endpoint, bytes.NewReader(x), 0, nil, data, options...)
 }
 
 // Options issues a HTTP OPTIONS request and returns the raw data.
-func (connection *Connection) Options(endpoint string) ([]byte, error) {
+func (connection *Connection) Options(endpoint string, options ...RequestOption) ([]byte, error) {
 	var x []byte
-	return connection.request("OPTIONS", endpoint, x)
+	return connection.request("OPTIONS", endpoint, x, options...)
 }
 
 // OptionsJSON issues a HTTP OPTIONS request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) OptionsJSON(endpoint string, data interface{}) error {
+func (connection *Connection) OptionsJSON(endpoint string, data interface{}, options ...RequestOption) error {
 	var x []byte
-
-	response, err := connection.request("OPTIONS", endpoint, x)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+	return connection.requestJSON("OPTIONS", endpoint, bytes.NewReader(x), 0, nil, data, options...)
 }
 
 // Patch issues a HTTP PATCH (RFC 5789) request and returns the raw data.
-func (connection *Connection) Patch(endpoint string, jsonData []byte) ([]byte, error) {
-	return connection.request("PATCH", endpoint, jsonData)
+func (connection *Connection) Patch(endpoint string, jsonData []byte, options ...RequestOption) ([]byte, error) {
+	return connection.request("PATCH", endpoint, jsonData, options...)
 }
 
 // PatchJSON issues a HTTP PATCH request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) PatchJSON(endpoint string, jsonData []byte, data interface{}) error {
-	response, err := connection.request("PATCH", endpoint, jsonData)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+func (connection *Connection) PatchJSON(endpoint string, jsonData []byte, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("PATCH", endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, data, options...)
 }
 
 // Post issues a HTTP POST request and returns the raw data.
-func (connection *Connection) Post(endpoint string, jsonData []byte) ([]byte, error) {
-	return connection.request("POST", endpoint, jsonData)
+func (connection *Connection) Post(endpoint string, jsonData []byte, options ...RequestOption) ([]byte, error) {
+	return connection.request("POST", endpoint, jsonData, options...)
 }
 
 // PostJSON issues a HTTP POST request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) PostJSON(endpoint string, jsonData []byte, data interface{}) error {
-	response, err := connection.request("POST", endpoint, jsonData)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+func (connection *Connection) PostJSON(endpoint string, jsonData []byte, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("POST", endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, data, options...)
 }
 
 // Put issues a HTTP PUT request and returns the raw data.
-func (connection *Connection) Put(endpoint string, jsonData []byte) ([]byte, error) {
-	return connection.request("PUT", endpoint, jsonData)
+func (connection *Connection) Put(endpoint string, jsonData []byte, options ...RequestOption) ([]byte, error) {
+	return connection.request("PUT", endpoint, jsonData, options...)
 }
 
 // PutJSON issues a HTTP PUT request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) PutJSON(endpoint string, jsonData []byte, data interface{}) error {
-	response, err := connection.request("PUT", endpoint, jsonData)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+func (connection *Connection) PutJSON(endpoint string, jsonData []byte, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("PUT", endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, data, options...)
 }
 
 // Trace issues a HTTP TRACE request and returns the raw data.
-func (connection *Connection) Trace(endpoint string) ([]byte, error) {
+func (connection *Connection) Trace(endpoint string, options ...RequestOption) ([]byte, error) {
 	var x []byte
-	return connection.request("TRACE", endpoint, x)
+	return connection.request("TRACE", endpoint, x, options...)
 }
 
 // TraceJSON issues a HTTP TRACE request, parses the resulting data as JSON and returns the parse results.
-func (connection *Connection) TraceJSON(endpoint string, data interface{}) error {
+func (connection *Connection) TraceJSON(endpoint string, data interface{}, options ...RequestOption) error {
 	var x []byte
-
-	response, err := connection.request("TRACE", endpoint, x)
-	err2 := json.Unmarshal(response, data)
-	if err2 != nil {
-		if err != nil {
-			return err
-		}
-		return err2
-	}
-	return err
+	return connection.requestJSON("TRACE", endpoint, bytes.NewReader(x), 0, nil, data, options...)
 }
@@ -694,3 +694,19 @@ func checkJSONError(err error, t *testing.T) {
 		}
 	}
 }
+
+func newTestConnection(t *testing.T, server *httptest.Server) *Connection {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Could not parse test server url: %v", err.Error())
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("Could not parse test server port: %v", err.Error())
+	}
+	connection, err := NewConnection(u.Scheme == "https", u.Hostname(), port, "", "", "", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	return connection
+}
@@ -0,0 +1,198 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Multipart builds a multipart/form-data body from fields, files and readers.
+// The body is encoded while it is read, so the content of the parts is never
+// held in memory completely.
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+	progress func(written int64)
+}
+
+// multipartPart is a part of a Multipart body. The content is read from reader or,
+// if path is set, from the file at path, which is opened when the body is read.
+type multipartPart struct {
+	header textproto.MIMEHeader
+	reader io.Reader
+	path   string
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipart creates an empty multipart body with a random boundary.
+func NewMultipart() *Multipart {
+	return &Multipart{
+		boundary: multipart.NewWriter(io.Discard).Boundary(),
+	}
+}
+
+// AddField adds a form field with the given value.
+func (m *Multipart) AddField(name string, value string) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(name)))
+	m.AddPart(header, strings.NewReader(value))
+}
+
+// AddFile adds the file at path as form field. The file name is the base name of
+// path, the content type is guessed from the extension and defaults to
+// application/octet-stream. The file is opened when the body is read, AddFile only
+// checks that it exists.
+func (m *Multipart) AddFile(field string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	m.parts = append(m.parts, multipartPart{
+		header: fileHeader(field, filepath.Base(path), contentType),
+		path:   path,
+	})
+	return nil
+}
+
+// AddReader adds the content read from r as file with the given file name to the
+// form field. An empty contentType defaults to application/octet-stream. Like all
+// bodies passed to lra, r is not closed.
+func (m *Multipart) AddReader(field string, filename string, r io.Reader, contentType string) {
+	m.AddPart(fileHeader(field, filename, contentType), r)
+}
+
+// AddPart adds a part with arbitrary headers and the content read from r. The
+// header should contain a Content-Disposition.
+func (m *Multipart) AddPart(header textproto.MIMEHeader, r io.Reader) {
+	m.parts = append(m.parts, multipartPart{header: header, reader: r})
+}
+
+// OnProgress sets a function called with the number of bytes of the body written
+// so far, every time a chunk of the body was read.
+func (m *Multipart) OnProgress(progress func(written int64)) {
+	m.progress = progress
+}
+
+// ContentType returns the Content-Type of the body including the boundary.
+func (m *Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Reader returns a reader producing the encoded body. Readers added with AddReader
+// and AddPart are consumed, so the body can only be read once. Errors opening or
+// reading the parts are returned by Read. Closing the reader stops the encoding.
+func (m *Multipart) Reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(m.write(&progressWriter{w: pw, progress: m.progress}))
+	}()
+	return pr
+}
+
+// write encodes the body to w.
+func (m *Multipart) write(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(m.boundary); err != nil {
+		return err
+	}
+	for _, part := range m.parts {
+		pw, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		if part.path != "" {
+			err = copyFile(pw, part.path)
+		} else {
+			_, err = io.Copy(pw, part.reader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func fileHeader(field string, filename string, contentType string) textproto.MIMEHeader {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(field), quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", contentType)
+	return header
+}
+
+// progressWriter reports the number of bytes written to w.
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	progress func(written int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.written)
+	}
+	return n, err
+}
+
+// PostMultipart issues a HTTP POST request with the multipart body m and returns
+// the raw data. The body is sent with chunked transfer encoding.
+func (connection *Connection) PostMultipart(endpoint string, m *Multipart, options ...RequestOption) ([]byte, error) {
+	return connection.requestMultipart("POST", endpoint, m, options...)
+}
+
+// PostMultipartJSON issues a HTTP POST request with the multipart body m, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PostMultipartJSON(endpoint string, m *Multipart, data interface{}, options ...RequestOption) error {
+	return connection.requestMultipartJSON("POST", endpoint, m, data, options...)
+}
+
+// PutMultipart issues a HTTP PUT request with the multipart body m and returns
+// the raw data. The body is sent with chunked transfer encoding.
+func (connection *Connection) PutMultipart(endpoint string, m *Multipart, options ...RequestOption) ([]byte, error) {
+	return connection.requestMultipart("PUT", endpoint, m, options...)
+}
+
+// PutMultipartJSON issues a HTTP PUT request with the multipart body m, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PutMultipartJSON(endpoint string, m *Multipart, data interface{}, options ...RequestOption) error {
+	return connection.requestMultipartJSON("PUT", endpoint, m, data, options...)
+}
+
+func (connection *Connection) requestMultipart(method string, endpoint string, m *Multipart, options ...RequestOption) ([]byte, error) {
+	body := m.Reader()
+	defer body.Close()
+	return connection.requestReader(method, endpoint, body, -1, http.Header{"Content-Type": {m.ContentType()}}, options...)
+}
+
+func (connection *Connection) requestMultipartJSON(method string, endpoint string, m *Multipart, data interface{}, options ...RequestOption) error {
+	body := m.Reader()
+	defer body.Close()
+	return connection.requestJSON(method, endpoint, body, -1, http.Header{"Content-Type": {m.ContentType()}}, data, options...)
+}
@@ -0,0 +1,113 @@
+package lra
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type multipartResult struct {
+	Method      string            `json:"method"`
+	ContentType string            `json:"contenttype"`
+	Fields      map[string]string `json:"fields"`
+	Files       map[string]string `json:"files"`
+	FileTypes   map[string]string `json:"filetypes"`
+	FileNames   map[string]string `json:"filenames"`
+}
+
+func newMultipartServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := multipartResult{
+			Method:      r.Method,
+			ContentType: r.Header.Get("Content-Type"),
+			Fields:      make(map[string]string),
+			Files:       make(map[string]string),
+			FileTypes:   make(map[string]string),
+			FileNames:   make(map[string]string),
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := io.ReadAll(part)
+			if part.FileName() == "" {
+				result.Fields[part.FormName()] = string(b)
+				continue
+			}
+			result.Files[part.FormName()] = string(b)
+			result.FileTypes[part.FormName()] = part.Header.Get("Content-Type")
+			result.FileNames[part.FormName()] = part.FileName()
+		}
+		b, _ := json.Marshal(result)
+		w.Write(b)
+	}))
+}
+
+func TestPostMultipart(t *testing.T) {
+	server := newMultipartServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, indata, 0600); err != nil {
+		t.Fatalf("Error writing file: %v", err.Error())
+	}
+	connection := newTestConnection(t, server)
+	for _, method := range []string{"POST", "PUT"} {
+		m := NewMultipart()
+		m.AddField("name", `quoted "value"`)
+		if err := m.AddFile("upload", path); err != nil {
+			t.Fatalf("Error adding file: %v", err.Error())
+		}
+		m.AddReader("attachment", "note.txt", strings.NewReader("some text"), "text/plain")
+		var written int64
+		m.OnProgress(func(n int64) { written = n })
+
+		var result multipartResult
+		var err error
+		if method == "POST" {
+			err = connection.PostMultipartJSON("/upload", m, &result)
+		} else {
+			err = connection.PutMultipartJSON("/upload", m, &result)
+		}
+		if err != nil {
+			t.Fatalf("Error uploading multipart body: %v", err.Error())
+		}
+		if result.Method != method || result.ContentType != m.ContentType() {
+			t.Errorf("Expected %v with Content-Type '%v', got %v and '%v' instead.", method, m.ContentType(), result.Method, result.ContentType)
+		}
+		if result.Fields["name"] != `quoted "value"` {
+			t.Errorf("Expected field value 'quoted \"value\"', got '%v' instead.", result.Fields["name"])
+		}
+		if result.Files["upload"] != string(indata) || result.FileNames["upload"] != "data.json" || result.FileTypes["upload"] != "application/json" {
+			t.Errorf("Expected data.json with type application/json, got '%v' with type '%v' instead.", result.FileNames["upload"], result.FileTypes["upload"])
+		}
+		if result.Files["attachment"] != "some text" || result.FileTypes["attachment"] != "text/plain" {
+			t.Errorf("Expected attachment 'some text', got '%v' with type '%v' instead.", result.Files["attachment"], result.FileTypes["attachment"])
+		}
+		if written < int64(len(indata)) {
+			t.Errorf("Expected progress of the whole body, got %v instead.", written)
+		}
+	}
+}
+
+func TestMultipart_AddFileMissing(t *testing.T) {
+	m := NewMultipart()
+	if err := m.AddFile("upload", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Expected an error for a missing file, got nil")
+	}
+}
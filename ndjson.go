@@ -0,0 +1,126 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+)
+
+// NDJSONContentType is the media type of newline delimited JSON.
+const NDJSONContentType = "application/x-ndjson"
+
+// NDJSONWriter writes values as newline delimited JSON, one document per line.
+type NDJSONWriter struct {
+	encoder *json.Encoder
+}
+
+// NewNDJSONWriter creates a NDJSONWriter writing to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &NDJSONWriter{encoder: encoder}
+}
+
+// Write encodes v as a single line of JSON.
+func (writer *NDJSONWriter) Write(v interface{}) error {
+	// json.Encoder terminates every document with a newline and never emits
+	// newlines inside of a document.
+	return writer.encoder.Encode(v)
+}
+
+// NDJSONSeq returns a reader producing the elements of seq as newline delimited
+// JSON. The elements are encoded while the reader is consumed, so only one of them
+// is held in memory. Encoding errors are returned by Read. Closing the reader
+// stops the iteration.
+func NDJSONSeq[T any](seq iter.Seq[T]) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		writer := NewNDJSONWriter(pw)
+		for v := range seq {
+			if err := writer.Write(v); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+// NDJSONChan returns a reader producing the values received from ch as newline
+// delimited JSON until ch is closed, see NDJSONSeq.
+func NDJSONChan[T any](ch <-chan T) io.ReadCloser {
+	return NDJSONSeq(func(yield func(T) bool) {
+		for v := range ch {
+			if !yield(v) {
+				return
+			}
+		}
+	})
+}
+
+// DecodeNDJSON returns an iterator over the newline delimited JSON documents read
+// from r. Empty lines are skipped. The iteration stops after the first error, which
+// is yielded together with the zero value of T.
+func DecodeNDJSON[T any](r io.Reader) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				var v T
+				if err := json.Unmarshal(line, &v); err != nil {
+					yield(v, err)
+					return
+				}
+				if !yield(v, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				var v T
+				yield(v, err)
+				return
+			}
+		}
+	}
+}
+
+// GetNDJSON issues a HTTP GET request and returns an iterator over the newline
+// delimited JSON documents of the response. Errors of the request are yielded as
+// the first element. The response is closed when the iteration ends.
+func GetNDJSON[T any](connection *Connection, endpoint string, options ...RequestOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		response, err := connection.stream(context.Background(), "GET", endpoint, nil, 0, http.Header{"Accept": {NDJSONContentType}}, options...)
+		if err != nil {
+			var v T
+			yield(v, err)
+			return
+		}
+		defer response.Close()
+		for v, err := range DecodeNDJSON[T](response.Body) {
+			if !yield(v, err) {
+				return
+			}
+		}
+	}
+}
+
+// PostNDJSON issues a HTTP POST request with a newline delimited JSON body read
+// from body, e.g. created by NDJSONSeq, and returns the unread response like
+// Stream. The body is sent with chunked transfer encoding and the Content-Type
+// application/x-ndjson. Like all bodies passed to lra, it is not closed.
+func (connection *Connection) PostNDJSON(endpoint string, body io.Reader, options ...RequestOption) (*Response, error) {
+	return connection.stream(context.Background(), "POST", endpoint, body, -1, http.Header{"Content-Type": {NDJSONContentType}}, options...)
+}
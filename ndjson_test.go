@@ -0,0 +1,134 @@
+package lra
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type ndjsonItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewNDJSONWriter(&buf)
+	writer.Write(ndjsonItem{ID: 1, Name: "<a>"})
+	writer.Write(map[string]string{"index": "x"})
+	expected := "{\"id\":1,\"name\":\"<a>\"}\n{\"index\":\"x\"}\n"
+	if buf.String() != expected {
+		t.Errorf("Expected '%v', got '%v' instead.", expected, buf.String())
+	}
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	input := "{\"id\":1,\"name\":\"a\"}\n\n{\"id\":2,\"name\":\"b\"}\r\n{\"id\":3,\"name\":\"c\"}"
+	var items []ndjsonItem
+	for item, err := range DecodeNDJSON[ndjsonItem](strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("Error decoding: %v", err.Error())
+		}
+		items = append(items, item)
+	}
+	if len(items) != 3 || items[2].Name != "c" {
+		t.Errorf("Expected 3 items, got %v instead.", items)
+	}
+
+	var count int
+	var decodeErr error
+	for _, err := range DecodeNDJSON[ndjsonItem](strings.NewReader("{\"id\":1}\n{{\n{\"id\":3}\n")) {
+		if err != nil {
+			decodeErr = err
+			continue
+		}
+		count++
+	}
+	if count != 1 || decodeErr == nil {
+		t.Errorf("Expected 1 item and an error, got %v items and '%v' instead.", count, decodeErr)
+	}
+}
+
+func TestNDJSON_RoundTrip(t *testing.T) {
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			contentType = r.Header.Get("Content-Type")
+		}
+		w.Header().Set("Content-Type", NDJSONContentType)
+		io.Copy(w, r.Body)
+		if r.Method == "GET" {
+			w.Write([]byte("{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"b\"}\n"))
+		}
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	body := NDJSONSeq(slices.Values([]ndjsonItem{{1, "a"}, {2, "b"}, {3, "c"}}))
+	defer body.Close()
+	response, err := connection.PostNDJSON("/_bulk", body)
+	if err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	defer response.Close()
+	if contentType != NDJSONContentType {
+		t.Errorf("Expected Content-Type '%v', got '%v' instead.", NDJSONContentType, contentType)
+	}
+	var ids []int
+	for item, err := range DecodeNDJSON[ndjsonItem](response.Body) {
+		if err != nil {
+			t.Fatalf("Error decoding: %v", err.Error())
+		}
+		ids = append(ids, item.ID)
+	}
+	if !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Errorf("Expected ids [1 2 3], got %v instead.", ids)
+	}
+
+	ids = nil
+	for item, err := range GetNDJSON[ndjsonItem](connection, "/logs") {
+		if err != nil {
+			t.Fatalf("Error decoding: %v", err.Error())
+		}
+		ids = append(ids, item.ID)
+		break
+	}
+	if !slices.Equal(ids, []int{1}) {
+		t.Errorf("Expected ids [1], got %v instead.", ids)
+	}
+}
+
+func TestNDJSONChan(t *testing.T) {
+	ch := make(chan ndjsonItem)
+	go func() {
+		ch <- ndjsonItem{1, "a"}
+		ch <- ndjsonItem{2, "b"}
+		close(ch)
+	}()
+	b, err := io.ReadAll(NDJSONChan(ch))
+	if err != nil {
+		t.Fatalf("Error reading: %v", err.Error())
+	}
+	expected := "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"b\"}\n"
+	if string(b) != expected {
+		t.Errorf("Expected '%v', got '%v' instead.", expected, string(b))
+	}
+}
+
+func TestGetNDJSON_Error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, err := range GetNDJSON[ndjsonItem](connection, "/missing") {
+		var statusError *StatusError
+		if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 *StatusError, got '%v' instead.", err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestOption changes a single request. Options are applied in order after the
+// SendHeaders of the connection and the headers lra sets itself, so they take
+// precedence over both.
+type RequestOption func(options *requestOptions)
+
+// requestOptions are the collected RequestOptions of a request.
+type requestOptions struct {
+	header   http.Header
+	remove   []string
+	query    url.Values
+	timeout  time.Duration
+	user     string
+	password string
+	auth     bool
+	vars     map[string]interface{}
+}
+
+// WithHeader sets the header name to value for the request.
+func WithHeader(name string, value string) RequestOption {
+	return func(options *requestOptions) {
+		options.header.Set(name, value)
+		options.remove = removeName(options.remove, name)
+	}
+}
+
+// WithoutHeader removes the header name from the request, e.g. one of the
+// SendHeaders of the connection.
+func WithoutHeader(name string) RequestOption {
+	return func(options *requestOptions) {
+		options.header.Del(name)
+		options.remove = append(options.remove, name)
+	}
+}
+
+// WithQuery adds the query parameter name with value to the endpoint.
+func WithQuery(name string, value string) RequestOption {
+	return func(options *requestOptions) {
+		options.query.Add(name, value)
+	}
+}
+
+// WithTimeout replaces the connection Timeout for the request. For streamed
+// responses it limits the time until the headers arrived, like the Timeout.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(options *requestOptions) {
+		options.timeout = timeout
+	}
+}
+
+// WithBasicAuth authenticates the request with user and password instead of the
+// credentials of the connection.
+func WithBasicAuth(user string, password string) RequestOption {
+	return func(options *requestOptions) {
+		options.user = user
+		options.password = password
+		options.auth = true
+	}
+}
+
+// WithTemplate expands the endpoint of the request as RFC 6570 URI template with
+// vars, see ExpandTemplate. Rate limiters, bulkheads and circuit breakers still
+// see the unexpanded endpoint, so all requests to a template share them.
+func WithTemplate(vars map[string]interface{}) RequestOption {
+	return func(options *requestOptions) {
+		options.vars = vars
+	}
+}
+
+func newRequestOptions(options []RequestOption) *requestOptions {
+	o := &requestOptions{
+		header: make(http.Header),
+		query:  make(url.Values),
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// apply sets the options on req.
+func (o *requestOptions) apply(req *http.Request) {
+	o.applyHeader(req.Header)
+	o.applyQuery(req.URL)
+	if o.auth {
+		req.SetBasicAuth(o.user, o.password)
+	}
+}
+
+// applyHeader sets and removes the headers of the options in header.
+func (o *requestOptions) applyHeader(header http.Header) {
+	for h, v := range o.header {
+		header[h] = v
+	}
+	for _, h := range o.remove {
+		header.Del(h)
+	}
+}
+
+// applyQuery adds the query parameters of the options to u.
+func (o *requestOptions) applyQuery(u *url.URL) {
+	if len(o.query) > 0 {
+		query := u.Query()
+		for name, values := range o.query {
+			query[name] = append(query[name], values...)
+		}
+		u.RawQuery = query.Encode()
+	}
+}
+
+// endpoint returns endpoint expanded with the variables of WithTemplate.
+func (o *requestOptions) endpoint(endpoint string) (string, error) {
+	if o == nil || o.vars == nil {
+		return endpoint, nil
+	}
+	return ExpandTemplate(endpoint, o.vars)
+}
+
+// basicAuth returns the value of an Authorization header for user and password.
+func basicAuth(user string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// client returns client or, if the request has its own timeout, a copy of it
+// with this timeout.
+func (o *requestOptions) client(client *http.Client) *http.Client {
+	if o.timeout <= 0 {
+		return client
+	}
+	c := *client
+	c.Timeout = o.timeout
+	return &c
+}
+
+func removeName(names []string, name string) []string {
+	var result []string
+	for _, n := range names {
+		if http.CanonicalHeaderKey(n) != http.CanonicalHeaderKey(name) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newOptionsServer reports the query, the Test-Header, the X-Extra header and
+// the basic auth user of the request and sleeps on /slow.
+func newOptionsServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Millisecond * 200)
+		}
+		user, _, _ := r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"method":"` + r.URL.RawQuery + `","stringdata":"` + r.Header.Get("Test-Header") + "|" + r.Header.Get("X-Extra") + "|" + user + `"}`))
+	}))
+}
+
+func TestRequestOptions(t *testing.T) {
+	server := newOptionsServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var data ReturnData
+	err := connection.GetJSON("/options?a=1", &data,
+		WithQuery("b", "2"),
+		WithQuery("b", "x y"),
+		WithHeader("X-Extra", "extra"),
+		WithBasicAuth("user", "secret"))
+	if err != nil {
+		t.Fatalf("Error getting JSON: %v", err.Error())
+	}
+	if data.Method != "a=1&b=2&b=x+y" {
+		t.Errorf("Expected query 'a=1&b=2&b=x+y', got '%v' instead.", data.Method)
+	}
+	if data.StringData != "test|extra|user" {
+		t.Errorf("Expected 'test|extra|user', got '%v' instead.", data.StringData)
+	}
+
+	if err := connection.PostJSON("/options", indata, &data, WithoutHeader("test-header"), WithHeader("Test-Header", "changed")); err != nil {
+		t.Fatalf("Error posting JSON: %v", err.Error())
+	}
+	if data.StringData != "changed||" {
+		t.Errorf("Expected 'changed||', got '%v' instead.", data.StringData)
+	}
+	if err := connection.GetJSON("/options", &data, WithoutHeader("Test-Header")); err != nil {
+		t.Fatalf("Error getting JSON: %v", err.Error())
+	}
+	if data.StringData != "||" {
+		t.Errorf("Expected the SendHeader to be removed, got '%v' instead.", data.StringData)
+	}
+	if connection.SendHeaders["test-header"] != "test" {
+		t.Errorf("Expected SendHeaders to be unchanged, got '%v' instead.", connection.SendHeaders)
+	}
+}
+
+func TestRequestOptions_Timeout(t *testing.T) {
+	server := newOptionsServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	_, err := connection.Get("/slow", WithTimeout(time.Millisecond*50))
+	if err == nil {
+		t.Errorf("Expected a timeout error, got nil")
+	}
+	if _, err := connection.Get("/slow"); err != nil {
+		t.Errorf("Expected the connection Timeout to apply without the option, got '%v' instead.", err)
+	}
+
+	_, err = connection.GetStream("/slow", WithTimeout(time.Millisecond*50))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the stream to be cancelled, got '%v' instead.", err)
+	}
+}
+
+func TestWithTemplate(t *testing.T) {
+	server := newBuilderServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var data ReturnData
+	vars := map[string]interface{}{"index": "logs", "id": "a/b c", "refresh": true}
+	if err := connection.GetJSON("/{index}/_doc/{id}{?refresh}", &data, WithTemplate(vars)); err != nil {
+		t.Fatalf("Error getting JSON: %v", err.Error())
+	}
+	if data.Path != "/logs/_doc/a%2Fb%20c" || data.Protocol != "refresh=true" {
+		t.Errorf("Expected '/logs/_doc/a%%2Fb%%20c?refresh=true', got '%v?%v' instead.", data.Path, data.Protocol)
+	}
+
+	if _, err := connection.Get("/{index}/_doc/{missing}", WithTemplate(vars)); err == nil {
+		t.Errorf("Expected an error for a missing variable, got nil")
+	}
+}
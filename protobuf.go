@@ -0,0 +1,102 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufContentType is the media type of Protocol Buffers in binary format.
+const ProtobufContentType = "application/x-protobuf"
+
+// ProtobufCodec encodes proto.Message values in the Protocol Buffers binary format.
+type ProtobufCodec struct{}
+
+// Marshal encodes v, which must be a proto.Message.
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("can not encode %T as protobuf, it is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal parses data into v, which must be a proto.Message.
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("can not decode protobuf into %T, it is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// ContentType returns application/x-protobuf.
+func (ProtobufCodec) ContentType() string { return ProtobufContentType }
+
+// ProtoJSONCodec encodes proto.Message values in the canonical JSON mapping of
+// Protocol Buffers. Unknown fields in responses are ignored.
+type ProtoJSONCodec struct{}
+
+// Marshal encodes v, which must be a proto.Message.
+func (ProtoJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("can not encode %T as protojson, it is not a proto.Message", v)
+	}
+	return protojson.Marshal(m)
+}
+
+// Unmarshal parses data into v, which must be a proto.Message.
+func (ProtoJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("can not decode protojson into %T, it is not a proto.Message", v)
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// ContentType returns application/json.
+func (ProtoJSONCodec) ContentType() string { return "application/json" }
+
+// SendProto issues a HTTP request with body encoded in the Protocol Buffers binary
+// format and decodes the response into result. The Accept header prefers the
+// binary format over JSON, a JSON response is decoded with ProtoJSONCodec. A nil
+// body sends no body, a nil result skips decoding.
+func (connection *Connection) SendProto(method string, endpoint string, body proto.Message, result proto.Message, options ...RequestOption) error {
+	header := http.Header{"Accept": {ProtobufContentType + ", application/json;q=0.5"}}
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = proto.Marshal(body)
+		if err != nil {
+			return err
+		}
+		header.Set("Content-Type", ProtobufContentType)
+	}
+	response, responseHeader, err := connection.requestHeader(method, endpoint, bytes.NewReader(data), int64(len(data)), header, options...)
+	if result == nil || responseHeader == nil {
+		return err
+	}
+	var codec Codec = ProtobufCodec{}
+	mediaType, _, _ := mime.ParseMediaType(responseHeader.Get("Content-Type"))
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		codec = ProtoJSONCodec{}
+	}
+	err2 := codec.Unmarshal(response, result)
+	if err2 != nil {
+		if err != nil {
+			return err
+		}
+		return err2
+	}
+	return err
+}
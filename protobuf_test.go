@@ -0,0 +1,68 @@
+package lra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newProtobufServer echoes a StringValue in upper case, as JSON if the client does
+// not accept protobuf.
+func newProtobufServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var codec Codec = ProtobufCodec{}
+		if !strings.HasPrefix(r.Header.Get("Accept"), ProtobufContentType) || r.URL.Path == "/json" {
+			codec = ProtoJSONCodec{}
+		}
+		in := new(wrapperspb.StringValue)
+		if r.Header.Get("Content-Type") == ProtobufContentType {
+			b, _ := io.ReadAll(r.Body)
+			if err := proto.Unmarshal(b, in); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		b, _ := codec.Marshal(wrapperspb.String(strings.ToUpper(in.GetValue())))
+		w.Header().Set("Content-Type", codec.ContentType())
+		w.Write(b)
+	}))
+}
+
+func TestSendProto(t *testing.T) {
+	server := newProtobufServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, endpoint := range []string{"/proto", "/json"} {
+		result := new(wrapperspb.StringValue)
+		if err := connection.SendProto("POST", endpoint, wrapperspb.String("hello"), result); err != nil {
+			t.Fatalf("Error sending protobuf to %v: %v", endpoint, err.Error())
+		}
+		if result.GetValue() != "HELLO" {
+			t.Errorf("Expected 'HELLO' from %v, got '%v' instead.", endpoint, result.GetValue())
+		}
+	}
+}
+
+func TestSend_ProtobufCodec(t *testing.T) {
+	server := newProtobufServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetDefaultCodec(ProtobufCodec{})
+	result := new(wrapperspb.StringValue)
+	if err := connection.Send("POST", "/proto", wrapperspb.String("codec"), result); err != nil {
+		t.Fatalf("Error sending protobuf: %v", err.Error())
+	}
+	if result.GetValue() != "CODEC" {
+		t.Errorf("Expected 'CODEC', got '%v' instead.", result.GetValue())
+	}
+	if err := connection.Send("POST", "/proto", "no message", result); err == nil {
+		t.Errorf("Expected an error for a value which is no proto.Message, got nil")
+	}
+}
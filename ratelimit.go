@@ -0,0 +1,259 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the number of requests per second.
+// Use NewRateLimiter to create one and Connection.SetRateLimiter to attach it.
+//
+// If Adaptive is set, the limiter additionally follows the quota announced by the
+// server in the X-RateLimit-Remaining/X-RateLimit-Reset, RateLimit-Remaining/
+// RateLimit-Reset or RateLimit headers and the Retry-After header of 429 and 503
+// responses. It slows down to spread the remaining requests until the reset and
+// blocks completely when the quota is exhausted. Adaptive must be set before the
+// limiter is used.
+type RateLimiter struct {
+	Adaptive bool
+
+	mu           sync.Mutex
+	rate         float64
+	burst        float64
+	current      float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second on average
+// and bursts of up to burst requests. A burst smaller than 1 is treated as 1.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		current: rate,
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// Rate returns the number of requests per second currently allowed. For adaptive
+// limiters, this may be lower than the configured rate.
+func (limiter *RateLimiter) Rate() float64 {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return limiter.current
+}
+
+// Wait blocks until the limiter allows a request or ctx is done.
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := limiter.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available and otherwise returns the time to
+// wait before trying again.
+func (limiter *RateLimiter) reserve(now time.Time) time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if now.Before(limiter.blockedUntil) {
+		return limiter.blockedUntil.Sub(now)
+	}
+	if limiter.current <= 0 {
+		// A limiter without a rate never refills and would block forever.
+		return 0
+	}
+	limiter.tokens = math.Min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.current)
+	limiter.last = now
+	if limiter.tokens >= 1 {
+		limiter.tokens--
+		return 0
+	}
+	return time.Duration((1 - limiter.tokens) / limiter.current * float64(time.Second))
+}
+
+// update adapts the limiter to the quota announced in the response headers.
+func (limiter *RateLimiter) update(response *http.Response) {
+	now := time.Now()
+	remaining, reset, ok := parseRateLimitHeaders(response.Header, now)
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		if delay, found := parseRetryAfter(response.Header.Get("Retry-After"), now); found {
+			limiter.block(now.Add(delay))
+			return
+		}
+	}
+	if !ok {
+		return
+	}
+	if remaining <= 0 {
+		limiter.block(now.Add(reset))
+		return
+	}
+	limiter.current = limiter.rate
+	if reset > 0 {
+		limiter.current = math.Min(limiter.rate, remaining/reset.Seconds())
+	}
+}
+
+func (limiter *RateLimiter) block(until time.Time) {
+	if until.After(limiter.blockedUntil) {
+		limiter.blockedUntil = until
+	}
+	// The quota is available again when the block ends.
+	limiter.tokens = 1
+	limiter.last = until
+}
+
+// parseRateLimitHeaders extracts the remaining requests and the time until the
+// quota is reset from the common rate limit headers.
+func parseRateLimitHeaders(header http.Header, now time.Time) (float64, time.Duration, bool) {
+	var remaining, reset string
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-", "X-Rate-Limit-"} {
+		if v := header.Get(prefix + "Remaining"); v != "" {
+			remaining = v
+			reset = header.Get(prefix + "Reset")
+			break
+		}
+	}
+	if remaining == "" {
+		// draft-ietf-httpapi-ratelimit-headers: RateLimit: limit=100, remaining=50, reset=30
+		for _, item := range strings.Split(header.Get("RateLimit"), ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "remaining", "r":
+				remaining = value
+			case "reset", "t":
+				reset = value
+			}
+		}
+	}
+	if remaining == "" {
+		return 0, 0, false
+	}
+	r, err := strconv.ParseFloat(strings.TrimSpace(remaining), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	var delay time.Duration
+	if reset != "" {
+		s, err := strconv.ParseFloat(strings.TrimSpace(reset), 64)
+		if err == nil {
+			// Some APIs send the reset as unix timestamp instead of seconds to wait.
+			if s > 1e9 {
+				delay = time.Unix(int64(s), 0).Sub(now)
+			} else {
+				delay = time.Duration(s * float64(time.Second))
+			}
+		}
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return r, delay, true
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or HTTP date format.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(value); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+type rateLimitRule struct {
+	method  string
+	pattern string
+	limiter *RateLimiter
+}
+
+// SetRateLimiter attaches a rate limiter to all requests with the given method
+// whose endpoint path matches pattern (see path.Match, e.g. "/index/*/_search").
+// An empty method matches all methods, an empty pattern all endpoints. A request
+// waits for all matching limiters, so a connection wide limit can be combined with
+// stricter limits for single endpoints. Passing a nil limiter removes the limiter
+// set for method and pattern.
+//
+// For requests with WithTemplate or built by NewRequest, pattern is matched
+// against the unexpanded template, e.g. "/{index}/_doc/*", not against the
+// expanded endpoint.
+func (connection *Connection) SetRateLimiter(method string, pattern string, limiter *RateLimiter) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	for i, rule := range connection.limiters {
+		if rule.method == method && rule.pattern == pattern {
+			if limiter == nil {
+				connection.limiters = append(connection.limiters[:i], connection.limiters[i+1:]...)
+			} else {
+				connection.limiters[i].limiter = limiter
+			}
+			return
+		}
+	}
+	if limiter != nil {
+		connection.limiters = append(connection.limiters, rateLimitRule{method: method, pattern: pattern, limiter: limiter})
+	}
+}
+
+// RateLimiters returns all rate limiters applying to a request with method to endpoint.
+func (connection *Connection) RateLimiters(method string, endpoint string) []*RateLimiter {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	var limiters []*RateLimiter
+	for _, rule := range connection.limiters {
+		if matchEndpoint(rule.method, rule.pattern, method, endpoint) {
+			limiters = append(limiters, rule.limiter)
+		}
+	}
+	return limiters
+}
+
+// matchEndpoint checks a request against the method and path pattern of a rule.
+// Empty rule values match everything, the query string is ignored.
+func matchEndpoint(ruleMethod string, pattern string, method string, endpoint string) bool {
+	if ruleMethod != "" && ruleMethod != method {
+		return false
+	}
+	if pattern == "" {
+		return true
+	}
+	p, _, _ := strings.Cut(endpoint, "?")
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
@@ -0,0 +1,118 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Burst(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.SetRateLimiter("", "", NewRateLimiter(20, 3))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := connection.Get("/api"); err != nil {
+			t.Fatalf("Error in request %v: %v", i, err.Error())
+		}
+	}
+	// 3 requests are covered by the burst, the other 2 need 50ms each.
+	if elapsed := time.Since(start); elapsed < time.Millisecond*90 {
+		t.Errorf("Expected requests to be limited to at least 90ms, took %v instead.", elapsed)
+	}
+}
+
+func TestRateLimiter_Context(t *testing.T) {
+	limiter := NewRateLimiter(0.1, 1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected first token to be available, got '%v' instead.", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got '%v' instead.", err)
+	}
+}
+
+func TestRateLimiter_Rules(t *testing.T) {
+	connection, err := NewConnection(false, "localhost", 80, "", "", "", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	global := NewRateLimiter(100, 1)
+	search := NewRateLimiter(10, 1)
+	post := NewRateLimiter(1, 1)
+	connection.SetRateLimiter("", "", global)
+	connection.SetRateLimiter("", "/*/_search", search)
+	connection.SetRateLimiter("POST", "", post)
+
+	if l := connection.RateLimiters("GET", "/index/_search?q=x"); len(l) != 2 || l[0] != global || l[1] != search {
+		t.Errorf("Expected global and search limiter for GET /index/_search, got %v instead.", l)
+	}
+	if l := connection.RateLimiters("POST", "/index/_doc"); len(l) != 2 || l[0] != global || l[1] != post {
+		t.Errorf("Expected global and post limiter for POST /index/_doc, got %v instead.", l)
+	}
+	connection.SetRateLimiter("", "", nil)
+	if l := connection.RateLimiters("GET", "/index/_doc"); len(l) != 0 {
+		t.Errorf("Expected no limiter after removal, got %v instead.", l)
+	}
+}
+
+func TestRateLimiter_Adaptive(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	limiter := NewRateLimiter(1000, 10)
+	limiter.Adaptive = true
+	connection.SetRateLimiter("", "", limiter)
+	start := time.Now()
+	connection.Get("/api")
+	connection.Get("/api")
+	if elapsed := time.Since(start); elapsed < time.Millisecond*900 {
+		t.Errorf("Expected second request to wait for the quota reset, took %v instead.", elapsed)
+	}
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		header    http.Header
+		remaining float64
+		reset     time.Duration
+		ok        bool
+	}{
+		{http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"10"}}, 5, time.Second * 10, true},
+		{http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"1700000030"}}, 5, time.Second * 30, true},
+		{http.Header{"Ratelimit-Remaining": {"7"}, "Ratelimit-Reset": {"2"}}, 7, time.Second * 2, true},
+		{http.Header{"Ratelimit": {"limit=100, remaining=50, reset=30"}}, 50, time.Second * 30, true},
+		{http.Header{}, 0, 0, false},
+	}
+	for _, test := range tests {
+		remaining, reset, ok := parseRateLimitHeaders(test.header, now)
+		if remaining != test.remaining || reset != test.reset || ok != test.ok {
+			t.Errorf("Expected %v/%v/%v for %v, got %v/%v/%v instead.", test.remaining, test.reset, test.ok, test.header, remaining, reset, ok)
+		}
+	}
+
+	limiter := NewRateLimiter(100, 1)
+	limiter.update(&http.Response{StatusCode: 200, Header: http.Header{"Ratelimit-Remaining": {"10"}, "Ratelimit-Reset": {"5"}}})
+	if rate := limiter.Rate(); rate != 2 {
+		t.Errorf("Expected adapted rate 2, got %v instead.", rate)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"io"
+	"net/http"
+)
+
+// setBody sets body as the body of req. A length of 0 sends no body, a negative
+// length sends the body with chunked transfer encoding.
+//
+// The body is never closed, so files can be passed directly. If body implements
+// io.Seeker, it is rewound to its current position when the request has to be
+// sent again, e.g. for a redirect or a fallback from HTTP/3.
+func setBody(req *http.Request, body io.Reader, length int64) {
+	if body == nil || length == 0 {
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		req.ContentLength = 0
+		return
+	}
+	req.Body = io.NopCloser(body)
+	req.ContentLength = length
+	if length < 0 {
+		req.ContentLength = -1
+	}
+	if seeker, ok := body.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return io.NopCloser(body), nil
+			}
+		}
+	}
+}
+
+// DeleteReader issues a HTTP DELETE request with the body read from body and returns
+// the raw data. Length is the size of the body or -1 if it is unknown, in which case
+// the body is sent with chunked transfer encoding.
+func (connection *Connection) DeleteReader(endpoint string, body io.Reader, length int64, options ...RequestOption) ([]byte, error) {
+	return connection.requestReader("DELETE", endpoint, body, length, nil, options...)
+}
+
+// DeleteReaderJSON issues a HTTP DELETE request with the body read from body, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) DeleteReaderJSON(endpoint string, body io.Reader, length int64, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("DELETE", endpoint, body, length, nil, data, options...)
+}
+
+// PatchReader issues a HTTP PATCH request with the body read from body and returns
+// the raw data. Length is the size of the body or -1 if it is unknown, in which case
+// the body is sent with chunked transfer encoding.
+func (connection *Connection) PatchReader(endpoint string, body io.Reader, length int64, options ...RequestOption) ([]byte, error) {
+	return connection.requestReader("PATCH", endpoint, body, length, nil, options...)
+}
+
+// PatchReaderJSON issues a HTTP PATCH request with the body read from body, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PatchReaderJSON(endpoint string, body io.Reader, length int64, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("PATCH", endpoint, body, length, nil, data, options...)
+}
+
+// PostReader issues a HTTP POST request with the body read from body and returns
+// the raw data. Length is the size of the body or -1 if it is unknown, in which case
+// the body is sent with chunked transfer encoding.
+func (connection *Connection) PostReader(endpoint string, body io.Reader, length int64, options ...RequestOption) ([]byte, error) {
+	return connection.requestReader("POST", endpoint, body, length, nil, options...)
+}
+
+// PostReaderJSON issues a HTTP POST request with the body read from body, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PostReaderJSON(endpoint string, body io.Reader, length int64, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("POST", endpoint, body, length, nil, data, options...)
+}
+
+// PutReader issues a HTTP PUT request with the body read from body and returns
+// the raw data. Length is the size of the body or -1 if it is unknown, in which case
+// the body is sent with chunked transfer encoding.
+func (connection *Connection) PutReader(endpoint string, body io.Reader, length int64, options ...RequestOption) ([]byte, error) {
+	return connection.requestReader("PUT", endpoint, body, length, nil, options...)
+}
+
+// PutReaderJSON issues a HTTP PUT request with the body read from body, parses the resulting data as JSON and returns the parse results.
+func (connection *Connection) PutReaderJSON(endpoint string, body io.Reader, length int64, data interface{}, options ...RequestOption) error {
+	return connection.requestJSON("PUT", endpoint, body, length, nil, data, options...)
+}
@@ -0,0 +1,106 @@
+package lra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+		w.Header().Set("X-Method", r.Method)
+		w.Write(b)
+	}))
+}
+
+func TestPostReader_KnownLength(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, method := range []string{"DELETE", "PATCH", "POST", "PUT"} {
+		var b []byte
+		var err error
+		body := strings.NewReader(string(indata))
+		switch method {
+		case "DELETE":
+			b, err = connection.DeleteReader("/echo", body, int64(len(indata)))
+		case "PATCH":
+			b, err = connection.PatchReader("/echo", body, int64(len(indata)))
+		case "POST":
+			b, err = connection.PostReader("/echo", body, int64(len(indata)))
+		case "PUT":
+			b, err = connection.PutReader("/echo", body, int64(len(indata)))
+		}
+		if err != nil {
+			t.Fatalf("Error in %v request: %v", method, err.Error())
+		}
+		if string(b) != string(indata) {
+			t.Errorf("Expected %v body '%v', got '%v' instead.", method, string(indata), string(b))
+		}
+	}
+}
+
+func TestPostReader_Chunked(t *testing.T) {
+	var contentLength, transferEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = strconv.FormatInt(r.ContentLength, 10)
+		transferEncoding = strings.Join(r.TransferEncoding, ",")
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(indata)
+		pw.Close()
+	}()
+	data := make(map[string]interface{})
+	if err := connection.PostReaderJSON("/", pr, -1, &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["stringdata"] != "hello" {
+		t.Errorf("Expected stringdata 'hello', got '%v' instead.", data["stringdata"])
+	}
+	if contentLength != "-1" || transferEncoding != "chunked" {
+		t.Errorf("Expected chunked body without length, got length %v and transfer encoding '%v' instead.", contentLength, transferEncoding)
+	}
+}
+
+func TestPutReader_RewindOnRedirect(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "body.json"))
+	if err != nil {
+		t.Fatalf("Error creating file: %v", err.Error())
+	}
+	defer file.Close()
+	file.Write(indata)
+	file.Seek(0, io.SeekStart)
+
+	connection := newTestConnection(t, server)
+	data := make(map[string]interface{})
+	if err := connection.PutReaderJSON("/redirect", file, -1, &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["stringdata"] != "hello" {
+		t.Errorf("Expected body to be sent again after redirect, got '%v' instead.", data)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Errorf("Expected file to stay open, got '%v' instead.", err)
+	}
+}
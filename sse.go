@@ -0,0 +1,187 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventStreamContentType is the media type of Server-Sent Events.
+const EventStreamContentType = "text/event-stream"
+
+// Event is a single Server-Sent Event. Retry is the reconnection time sent by
+// the server together with the event, or zero.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// ErrNotEventStream is returned when the response to an event stream request has
+// a Content-Type other than text/event-stream.
+var ErrNotEventStream = errors.New("response is not an event stream")
+
+// ErrEventStreamClosed is returned when the server ended the event stream with
+// status 204 No Content, which asks the client not to reconnect.
+var ErrEventStreamClosed = errors.New("event stream closed by server")
+
+// defaultEventRetry is the reconnection time until the server sends one.
+const defaultEventRetry = time.Second * 3
+
+// Events subscribes to the Server-Sent Events at endpoint and returns an
+// iterator over the received events.
+//
+// When the connection is lost, Events reconnects after the retry time announced
+// by the server (3s by default) and sends the id of the last event in the
+// Last-Event-ID header. Errors of a connection attempt are yielded with a nil
+// event, the iteration continues with the next attempt unless the loop is left.
+// Status codes above 399, ErrNotEventStream and ErrEventStreamClosed end the
+// iteration after being yielded. The iteration also ends when ctx is done.
+func (connection *Connection) Events(ctx context.Context, endpoint string, options ...RequestOption) iter.Seq2[*Event, error] {
+	return func(yield func(*Event, error) bool) {
+		lastID := ""
+		retry := defaultEventRetry
+		for {
+			err := connection.readEvents(ctx, endpoint, &lastID, &retry, yield, options...)
+			if ctx.Err() != nil || err == errStopEvents {
+				return
+			}
+			if err != nil {
+				if !yield(nil, err) || isFatalEventError(err) {
+					return
+				}
+			}
+			timer := time.NewTimer(retry)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// EventsChan subscribes to the Server-Sent Events at endpoint like Events and
+// delivers the events on the returned channel. Connection errors are retried
+// silently, the channel is closed when the stream ends for good or ctx is done.
+func (connection *Connection) EventsChan(ctx context.Context, endpoint string, options ...RequestOption) <-chan *Event {
+	ch := make(chan *Event)
+	go func() {
+		defer close(ch)
+		for event, err := range connection.Events(ctx, endpoint, options...) {
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// errStopEvents signals that the consumer left the iteration.
+var errStopEvents = errors.New("stop")
+
+func isFatalEventError(err error) bool {
+	var statusError *StatusError
+	return errors.As(err, &statusError) || err == ErrNotEventStream || err == ErrEventStreamClosed
+}
+
+// readEvents opens the event stream once and yields its events until the stream
+// ends. The id of the last event and the retry time are kept in lastID and retry
+// for the next connection.
+func (connection *Connection) readEvents(ctx context.Context, endpoint string, lastID *string, retry *time.Duration, yield func(*Event, error) bool, options ...RequestOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	header := http.Header{
+		"Accept":        {EventStreamContentType},
+		"Cache-Control": {"no-cache"},
+	}
+	if *lastID != "" {
+		header.Set("Last-Event-ID", *lastID)
+	}
+	response, err := connection.stream(ctx, "GET", endpoint, nil, 0, header, options...)
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return ErrEventStreamClosed
+	}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType != EventStreamContentType {
+		return ErrNotEventStream
+	}
+
+	reader := bufio.NewReader(response.Body)
+	event := &Event{ID: *lastID}
+	var data strings.Builder
+	hasData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// An incomplete event at the end of the stream is discarded.
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if hasData {
+				event.Data = data.String()
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if !yield(event, nil) {
+					return errStopEvents
+				}
+			}
+			event = &Event{ID: *lastID}
+			data.Reset()
+			hasData = false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				*lastID = value
+				event.ID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				*retry = time.Duration(ms) * time.Millisecond
+				event.Retry = *retry
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newEventServer(lastIDs chan<- string) *httptest.Server {
+	var connections atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		switch connections.Add(1) {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			w.Write([]byte(": comment\nretry: 10\n\nid: 1\nevent: progress\ndata: {\"percent\":50}\n\n"))
+			w.Write([]byte("id: 2\ndata: line1\r\ndata: line2\r\n\r\ndata: incomplete"))
+		case 2:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: resumed\n\n"))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestEvents_Reconnect(t *testing.T) {
+	lastIDs := make(chan string, 10)
+	server := newEventServer(lastIDs)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	var events []*Event
+	var streamErr error
+	for event, err := range connection.Events(context.Background(), "/events") {
+		if err != nil {
+			streamErr = err
+			continue
+		}
+		events = append(events, event)
+	}
+	if !errors.Is(streamErr, ErrEventStreamClosed) {
+		t.Errorf("Expected ErrEventStreamClosed, got '%v' instead.", streamErr)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %v instead.", len(events))
+	}
+	expected := []Event{
+		{ID: "1", Event: "progress", Data: `{"percent":50}`},
+		{ID: "2", Event: "message", Data: "line1\nline2"},
+		{ID: "2", Event: "message", Data: "resumed"},
+	}
+	for i := range expected {
+		if events[i].ID != expected[i].ID || events[i].Event != expected[i].Event || events[i].Data != expected[i].Data {
+			t.Errorf("Expected event %+v, got %+v instead.", expected[i], *events[i])
+		}
+	}
+	if <-lastIDs != "" || <-lastIDs != "2" || <-lastIDs != "2" {
+		t.Errorf("Expected Last-Event-ID '', '2' and '2'.")
+	}
+}
+
+func TestEvents_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := connection.EventsChan(ctx, "/events")
+	event := <-ch
+	if event == nil || event.Data != "first" {
+		t.Fatalf("Expected event 'first', got %v instead.", event)
+	}
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Expected channel to be closed after cancel.")
+		}
+	case <-time.After(time.Second * 5):
+		t.Errorf("Timed out waiting for the channel to be closed.")
+	}
+}
+
+func TestEvents_NotEventStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	for _, err := range connection.Events(context.Background(), "/events") {
+		if err != ErrNotEventStream {
+			t.Errorf("Expected ErrNotEventStream, got '%v' instead.", err)
+		}
+	}
+}
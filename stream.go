@@ -0,0 +1,153 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxErrorBody is the number of bytes of an error response kept in a StatusError
+// by the streaming functions.
+const maxErrorBody = 64 * 1024
+
+// StatusError is returned for responses with a status code above 399. Its message
+// is the status line of the response, e.g. "404 Not Found".
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+func newStatusError(r *http.Response, body []byte) *StatusError {
+	return &StatusError{
+		StatusCode: r.StatusCode,
+		Status:     r.Status,
+		Header:     r.Header,
+		Body:       body,
+	}
+}
+
+// Error returns the status line of the response.
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// Response is a response whose body has not been read yet. The caller must
+// close the Body (or the Response) when done.
+//
+// If the body was decoded from a Content-Encoding, ContentEncoding contains the
+// original encoding, see SetResponseDecompression.
+type Response struct {
+	StatusCode      int
+	Status          string
+	Header          http.Header
+	Body            io.ReadCloser
+	ContentEncoding string
+
+	compressed *countingReader
+}
+
+// Close closes the body of the response.
+func (response *Response) Close() error {
+	return response.Body.Close()
+}
+
+// CompressedSize returns the number of bytes of the encoded body read so far,
+// which is the compressed size of the body after it was read completely. It
+// returns -1 if the body was not decoded.
+func (response *Response) CompressedSize() int64 {
+	if response.compressed == nil {
+		return -1
+	}
+	return response.compressed.count()
+}
+
+// Stream issues a HTTP request and returns the response as soon as the headers
+// arrived, without reading the body. The connection Timeout only applies until
+// the headers are received, reading the body is not limited in time.
+//
+// For responses with a status code above 399, the body is closed and a
+// *StatusError containing the first 64 KiB of the body is returned.
+func (connection *Connection) Stream(method string, endpoint string, jsonData []byte, options ...RequestOption) (*Response, error) {
+	return connection.stream(context.Background(), method, endpoint, bytes.NewReader(jsonData), int64(len(jsonData)), nil, options...)
+}
+
+// stream sends a request with the body read from body, see setBody for length.
+// Header is set on the request in addition to the headers of the connection.
+// The request is cancelled when ctx is done, also while the body is read.
+func (connection *Connection) stream(ctx context.Context, method string, endpoint string, body io.Reader, length int64, header http.Header, options ...RequestOption) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	o := newRequestOptions(options)
+	req, err := connection.newRequest(ctx, method, endpoint, body, length, header, o)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	client := *connection.httpClient()
+	client.Timeout = 0
+	timeout := connection.Timeout
+	if o.timeout > 0 {
+		timeout = o.timeout
+	}
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, cancel)
+	}
+	r, err := connection.do(&client, req, endpoint)
+	if timer != nil {
+		timer.Stop()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	decoded := decompressResponse(r)
+	rc := &cancelBody{ReadCloser: r.Body, cancel: cancel}
+	if r.StatusCode > 399 {
+		defer rc.Close()
+		b, _ := io.ReadAll(io.LimitReader(rc, maxErrorBody))
+		return nil, newStatusError(r, b)
+	}
+	response := &Response{
+		StatusCode: r.StatusCode,
+		Status:     r.Status,
+		Header:     r.Header,
+		Body:       rc,
+	}
+	if decoded != nil {
+		response.ContentEncoding = decoded.encoding
+		response.compressed = decoded.counter
+	}
+	return response, nil
+}
+
+// GetStream issues a HTTP GET request and returns the unread response, see Stream.
+func (connection *Connection) GetStream(endpoint string, options ...RequestOption) (*Response, error) {
+	var x []byte
+	return connection.Stream("GET", endpoint, x, options...)
+}
+
+// PostStream issues a HTTP POST request and returns the unread response, see Stream.
+func (connection *Connection) PostStream(endpoint string, jsonData []byte, options ...RequestOption) (*Response, error) {
+	return connection.Stream("POST", endpoint, jsonData, options...)
+}
+
+// cancelBody releases the context of a streamed request when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
@@ -0,0 +1,109 @@
+package lra
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStream_OK(t *testing.T) {
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Test-Header") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Chunks", "3")
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			// Longer than the connection timeout, which only applies to the headers.
+			time.Sleep(time.Millisecond * 150)
+		}
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.Timeout = time.Millisecond * 100
+	connection.Client.Timeout = connection.Timeout
+	response, err := connection.GetStream("/export")
+	if err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	defer response.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("X-Chunks") != "3" {
+		t.Errorf("Expected status 200 and X-Chunks 3, got %v and '%v' instead.", response.StatusCode, response.Header.Get("X-Chunks"))
+	}
+	b, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("Error reading body: %v", err.Error())
+	}
+	if len(b) != 3*len(chunk) {
+		t.Errorf("Expected %v bytes, got %v instead.", 3*len(chunk), len(b))
+	}
+}
+
+func TestStream_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"index_not_found"}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	response, err := connection.PostStream("/missing/_search", indata)
+	if response != nil {
+		t.Errorf("Expected no response, got %v instead.", response)
+	}
+	var statusError *StatusError
+	if !errors.As(err, &statusError) {
+		t.Fatalf("Expected *StatusError, got '%v' instead.", err)
+	}
+	if err.Error() != "404 Not Found" || statusError.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected '404 Not Found', got '%v' instead.", err)
+	}
+	if string(statusError.Body) != `{"error":"index_not_found"}` {
+		t.Errorf("Expected error body, got '%v' instead.", string(statusError.Body))
+	}
+}
+
+func TestStream_HeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	connection.Timeout = time.Millisecond * 50
+	if _, err := connection.GetStream("/slow"); err == nil {
+		t.Errorf("Expected timeout error, got nil")
+	}
+}
+
+func TestStream_Bulkhead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	bulkhead := NewBulkhead(1, time.Millisecond*20)
+	connection.SetBulkhead(bulkhead)
+	response, err := connection.GetStream("/")
+	if err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if _, err := connection.Get("/"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected the open stream to hold the slot, got '%v' instead.", err)
+	}
+	response.Close()
+	if _, err := connection.Get("/"); err != nil {
+		t.Errorf("Expected the slot to be free after Close, got '%v' instead.", err)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// templateOperator describes the expansion of an expression operator as defined
+// in RFC 6570, section 3.2.1.
+type templateOperator struct {
+	first    string
+	sep      string
+	named    bool
+	ifEmpty  string
+	reserved bool
+}
+
+var templateOperators = map[byte]templateOperator{
+	'+': {first: "", sep: ",", reserved: true},
+	'#': {first: "#", sep: ",", reserved: true},
+	'.': {first: ".", sep: "."},
+	'/': {first: "/", sep: "/"},
+	';': {first: ";", sep: ";", named: true},
+	'?': {first: "?", sep: "&", named: true, ifEmpty: "="},
+	'&': {first: "&", sep: "&", named: true, ifEmpty: "="},
+}
+
+// ExpandTemplate expands the RFC 6570 URI template with vars, e.g.
+//
+//	ExpandTemplate("/{index}/_doc/{id}{?refresh}", map[string]interface{}{
+//		"index": "logs", "id": "a/b c", "refresh": true,
+//	})
+//
+// returns "/logs/_doc/a%2Fb%20c?refresh=true". All levels of the RFC are
+// supported: simple {var}, reserved {+var}, fragment {#var}, label {.var},
+// path segment {/var}, path parameter {;var}, query {?var} and query
+// continuation {&var} expansions, with the prefix {var:3} and explode {var*}
+// modifiers.
+//
+// Values may be strings, []string, map[string]string or any other value
+// formatted with fmt.Sprint. Except in reserved and fragment expansions, every
+// character but the unreserved ones is percent-encoded, so values can not add
+// path segments or query parameters. Unlike the RFC, which skips undefined
+// variables, a variable missing from vars is an error.
+func ExpandTemplate(template string, vars map[string]interface{}) (string, error) {
+	var result strings.Builder
+	rest := template
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			result.WriteString(rest)
+			break
+		}
+		if rest[start] == '}' {
+			return "", fmt.Errorf("template %q: unexpected '}'", template)
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("template %q: unterminated expression", template)
+		}
+		result.WriteString(rest[:start])
+		if err := expandExpression(&result, rest[start+1:start+end], vars); err != nil {
+			return "", fmt.Errorf("template %q: %w", template, err)
+		}
+		rest = rest[start+end+1:]
+	}
+	return result.String(), nil
+}
+
+// expandExpression writes the expansion of the expression without its braces.
+func expandExpression(result *strings.Builder, expression string, vars map[string]interface{}) error {
+	op := templateOperator{sep: ","}
+	if expression != "" {
+		if o, ok := templateOperators[expression[0]]; ok {
+			op = o
+			expression = expression[1:]
+		} else if strings.IndexByte("=,!@|", expression[0]) >= 0 {
+			return fmt.Errorf("reserved operator %q", expression[0])
+		}
+	}
+	if expression == "" {
+		return fmt.Errorf("empty expression")
+	}
+	first := true
+	for _, varspec := range strings.Split(expression, ",") {
+		name, prefix, explode, err := parseVarspec(varspec)
+		if err != nil {
+			return err
+		}
+		value, ok := vars[name]
+		if !ok || value == nil {
+			return fmt.Errorf("missing variable %q", name)
+		}
+		var s strings.Builder
+		defined, err := expandValue(&s, op, name, value, prefix, explode)
+		if err != nil {
+			return err
+		}
+		if !defined {
+			continue
+		}
+		if first {
+			result.WriteString(op.first)
+			first = false
+		} else {
+			result.WriteString(op.sep)
+		}
+		result.WriteString(s.String())
+	}
+	return nil
+}
+
+// parseVarspec splits a variable specification into the name and its prefix
+// length or explode modifier.
+func parseVarspec(varspec string) (string, int, bool, error) {
+	name := varspec
+	prefix := 0
+	explode := false
+	if strings.HasSuffix(name, "*") {
+		name = name[:len(name)-1]
+		explode = true
+	} else if i := strings.IndexByte(name, ':'); i >= 0 {
+		n, err := strconv.Atoi(name[i+1:])
+		if err != nil || n < 1 || n > 9999 || name[i+1] == '0' {
+			return "", 0, false, fmt.Errorf("invalid prefix in %q", varspec)
+		}
+		name = name[:i]
+		prefix = n
+	}
+	if !validVarname(name) {
+		return "", 0, false, fmt.Errorf("invalid variable name %q", varspec)
+	}
+	return name, prefix, explode, nil
+}
+
+func validVarname(name string) bool {
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' || strings.Contains(name, "..") {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.':
+		case c == '%' && i+2 < len(name) && isHex(name[i+1]) && isHex(name[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandValue writes the expansion of a single variable. It returns false if the
+// value is an empty list or map, which the RFC treats as undefined.
+func expandValue(s *strings.Builder, op templateOperator, name string, value interface{}, prefix int, explode bool) (bool, error) {
+	var list []string
+	var pairs [][2]string
+	switch v := value.(type) {
+	case []string:
+		list = v
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			pairs = append(pairs, [2]string{k, v[k]})
+		}
+	default:
+		str := fmt.Sprint(value)
+		if op.named {
+			s.WriteString(name)
+			if str == "" {
+				s.WriteString(op.ifEmpty)
+				return true, nil
+			}
+			s.WriteByte('=')
+		}
+		if prefix > 0 && utf8.RuneCountInString(str) > prefix {
+			str = string([]rune(str)[:prefix])
+		}
+		escapeTemplateValue(s, str, op.reserved)
+		return true, nil
+	}
+
+	if prefix > 0 {
+		return false, fmt.Errorf("prefix modifier used with composite variable %q", name)
+	}
+	if len(list) == 0 && len(pairs) == 0 {
+		return false, nil
+	}
+	if !explode {
+		if op.named {
+			s.WriteString(name)
+			s.WriteByte('=')
+		}
+		for i, item := range list {
+			if i > 0 {
+				s.WriteByte(',')
+			}
+			escapeTemplateValue(s, item, op.reserved)
+		}
+		for i, pair := range pairs {
+			if i > 0 {
+				s.WriteByte(',')
+			}
+			escapeTemplateValue(s, pair[0], op.reserved)
+			s.WriteByte(',')
+			escapeTemplateValue(s, pair[1], op.reserved)
+		}
+		return true, nil
+	}
+	for i, item := range list {
+		if i > 0 {
+			s.WriteString(op.sep)
+		}
+		if op.named {
+			s.WriteString(name)
+			if item == "" {
+				s.WriteString(op.ifEmpty)
+				continue
+			}
+			s.WriteByte('=')
+		}
+		escapeTemplateValue(s, item, op.reserved)
+	}
+	for i, pair := range pairs {
+		if i > 0 {
+			s.WriteString(op.sep)
+		}
+		escapeTemplateValue(s, pair[0], op.reserved)
+		if op.named && pair[1] == "" {
+			s.WriteString(op.ifEmpty)
+			continue
+		}
+		s.WriteByte('=')
+		escapeTemplateValue(s, pair[1], op.reserved)
+	}
+	return true, nil
+}
+
+// escapeTemplateValue percent-encodes all bytes of value except the unreserved
+// characters or, if reserved is set, except the unreserved and reserved
+// characters and existing percent-encoded triplets.
+func escapeTemplateValue(s *strings.Builder, value string, reserved bool) {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case isUnreserved(c):
+			s.WriteByte(c)
+		case reserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) >= 0:
+			s.WriteByte(c)
+		case reserved && c == '%' && i+2 < len(value) && isHex(value[i+1]) && isHex(value[i+2]):
+			s.WriteString(value[i : i+3])
+			i += 2
+		default:
+			s.WriteByte('%')
+			s.WriteByte(hex[c>>4])
+			s.WriteByte(hex[c&15])
+		}
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,76 @@
+package lra
+
+import (
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]interface{}{
+		"var":   "value",
+		"hello": "Hello World!",
+		"path":  "/foo/bar",
+		"empty": "",
+		"x":     1024,
+		"y":     768,
+		"list":  []string{"red", "green", "blue"},
+		"keys":  map[string]string{"semi": ";", "dot": ".", "comma": ","},
+		"id":    "a/b c",
+		"none":  []string{},
+	}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"/index/{id}", "/index/a%2Fb%20c"},
+		{"{var}", "value"},
+		{"{hello}", "Hello%20World%21"},
+		{"{+hello}", "Hello%20World!"},
+		{"{+path}/here", "/foo/bar/here"},
+		{"{#path}", "#/foo/bar"},
+		{"X{.var}", "X.value"},
+		{"{/var,x}/here", "/value/1024/here"},
+		{"{;x,y,empty}", ";x=1024;y=768;empty"},
+		{"{?x,y,empty}", "?x=1024&y=768&empty="},
+		{"?fixed=yes{&x}", "?fixed=yes&x=1024"},
+		{"{var:3}", "val"},
+		{"{list}", "red,green,blue"},
+		{"{list*}", "red,green,blue"},
+		{"{/list*}", "/red/green/blue"},
+		{"{?list}", "?list=red,green,blue"},
+		{"{?list*}", "?list=red&list=green&list=blue"},
+		{"{keys}", "comma,%2C,dot,.,semi,%3B"},
+		{"{?keys*}", "?comma=%2C&dot=.&semi=%3B"},
+		{"/items{?none}", "/items"},
+		{"{/id}", "/a%2Fb%20c"},
+		{"{?id}", "?id=a%2Fb%20c"},
+	}
+	for _, test := range tests {
+		result, err := ExpandTemplate(test.template, vars)
+		if err != nil {
+			t.Errorf("Error expanding '%v': %v", test.template, err.Error())
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("Expected '%v' to expand to '%v', got '%v' instead.", test.template, test.expected, result)
+		}
+	}
+}
+
+func TestExpandTemplate_Errors(t *testing.T) {
+	vars := map[string]interface{}{"var": "value", "list": []string{"a"}}
+	for _, template := range []string{
+		"/{missing}",
+		"/{var",
+		"/var}",
+		"{}",
+		"{=var}",
+		"{var:0}",
+		"{var:x}",
+		"{list:2}",
+		"{va r}",
+	} {
+		if result, err := ExpandTemplate(template, vars); err == nil {
+			t.Errorf("Expected an error for '%v', got '%v' instead.", template, result)
+		}
+	}
+}
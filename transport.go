@@ -0,0 +1,167 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// TransportOptions configures the connection pool and protocol settings of the
+// http transport used by a Connection.
+//
+// MaxIdleConns, MaxIdleConnsPerHost, MaxConnsPerHost, IdleConnTimeout,
+// TLSHandshakeTimeout, ResponseHeaderTimeout, ExpectContinueTimeout and
+// ForceAttemptHTTP2 are passed to the http.Transport and have the same meaning
+// there, zero values mean no limit. DialTimeout and KeepAlive configure the
+// net.Dialer used for new connections, also for connecting to a SOCKS5 proxy.
+// If H2C is set, plain http connections use HTTP/2 with prior knowledge instead
+// of HTTP/1.1. It has no effect on https connections, which negotiate the
+// protocol as usual.
+//
+// If HTTP3 is set, https requests are sent via HTTP/3 (QUIC). When a HTTP/3
+// request fails before a response arrived, it is repeated via HTTP/2 or HTTP/1.1
+// and HTTP/3 is not used for HTTP3Backoff (default 5 minutes). The QUIC
+// connections use TLSHandshakeTimeout (or DialTimeout) for the handshake,
+// IdleConnTimeout as idle timeout and KeepAlive as keep-alive period, the other
+// pool settings and ResponseHeaderTimeout only apply to the fallback. HTTP/3 can
+// not be used with a proxy.
+type TransportOptions struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	ExpectContinueTimeout time.Duration
+	ForceAttemptHTTP2     bool
+	H2C                   bool
+	HTTP3                 bool
+	HTTP3Backoff          time.Duration
+}
+
+// DefaultTransportOptions returns the options NewConnection uses.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		MaxIdleConns:        200,
+		MaxIdleConnsPerHost: 100,
+	}
+}
+
+// SetTransportOptions replaces the http transport of the connection by one built
+// from options. Idle connections of the previous transport are closed, requests in
+// flight are finished on the previous transport. A previous HTTP/3 transport keeps
+// its UDP socket until the connection is closed, see Close.
+//
+// It is safe to call while requests are running: the Client of the connection is
+// replaced by a copy with the new transport, the previous Client is not modified.
+func (connection *Connection) SetTransportOptions(options TransportOptions) error {
+	tr, err := connection.newTransport(options)
+	if err != nil {
+		return err
+	}
+	connection.mu.Lock()
+	previous := connection.Client.Transport
+	client := *connection.Client
+	client.Transport = tr
+	connection.Client = &client
+	connection.TransportOptions = options
+	if closer, ok := previous.(io.Closer); ok {
+		connection.retired = append(connection.retired, closer)
+	}
+	connection.mu.Unlock()
+	if t, ok := previous.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
+
+// httpClient returns the current http client of the connection, see
+// SetTransportOptions.
+func (connection *Connection) httpClient() *http.Client {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	return connection.Client
+}
+
+// transportOptions returns the current transport options of the connection.
+func (connection *Connection) transportOptions() TransportOptions {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	return connection.TransportOptions
+}
+
+// newTransport builds a http transport from options and the TLS and proxy
+// settings of the connection.
+func (connection *Connection) newTransport(options TransportOptions) (http.RoundTripper, error) {
+	tr := &http.Transport{
+		DisableKeepAlives:     false,
+		IdleConnTimeout:       options.IdleConnTimeout,
+		MaxIdleConns:          options.MaxIdleConns,
+		MaxIdleConnsPerHost:   options.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       options.MaxConnsPerHost,
+		TLSHandshakeTimeout:   options.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+		ExpectContinueTimeout: options.ExpectContinueTimeout,
+		ForceAttemptHTTP2:     options.ForceAttemptHTTP2,
+	}
+	if !connection.ValidateSSL {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if options.DialTimeout != 0 || options.KeepAlive != 0 || (connection.Proxy != "" && connection.ProxyIsSocks) {
+		dialer, err := connection.newDialer(options)
+		if err != nil {
+			return nil, err
+		}
+		tr.DialContext = dialer.DialContext
+	}
+	if connection.Proxy != "" {
+		if !connection.ProxyIsSocks {
+			proxyURL, err := url.Parse(connection.Proxy)
+			if err != nil {
+				return nil, err
+			}
+			tr.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	if options.H2C && connection.Protocol == "http" {
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		protocols.SetHTTP2(true)
+		tr.Protocols = protocols
+	}
+	if options.HTTP3 {
+		if connection.Proxy != "" {
+			return nil, errHTTP3Proxy
+		}
+		return newHTTP3Transport(tr, options), nil
+	}
+	return tr, nil
+}
+
+// newDialer returns the dialer for new connections, which connects through the
+// SOCKS5 proxy of the connection if one is set.
+func (connection *Connection) newDialer(options TransportOptions) (proxy.ContextDialer, error) {
+	dialer := &net.Dialer{
+		Timeout:   options.DialTimeout,
+		KeepAlive: options.KeepAlive,
+	}
+	if connection.Proxy == "" || !connection.ProxyIsSocks {
+		return dialer, nil
+	}
+	socks, err := proxy.SOCKS5("tcp", connection.Proxy, nil, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return socks.(proxy.ContextDialer), nil
+}
@@ -0,0 +1,137 @@
+package lra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportOptions_Default(t *testing.T) {
+	connection, err := NewConnection(true, "localhost", 443, "", "", "", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	if connection.TransportOptions != DefaultTransportOptions() {
+		t.Errorf("Expected default transport options, got %+v instead.", connection.TransportOptions)
+	}
+	tr, ok := connection.Client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected *http.Transport, got %T instead.", connection.Client.Transport)
+	}
+	if tr.MaxIdleConns != 200 || tr.MaxIdleConnsPerHost != 100 || tr.IdleConnTimeout != 0 {
+		t.Errorf("Expected MaxIdleConns 200, MaxIdleConnsPerHost 100 and IdleConnTimeout 0, got %v, %v and %v instead.", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+	if tr.DialContext != nil || tr.TLSHandshakeTimeout != 0 || tr.ResponseHeaderTimeout != 0 {
+		t.Errorf("Expected no dial, TLS handshake and response header timeouts.")
+	}
+	if tr.TLSClientConfig == nil || !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("Expected TLS verification to be skipped.")
+	}
+}
+
+func TestSetTransportOptions(t *testing.T) {
+	connection, err := NewConnection(false, "localhost", 80, "", "", "", false, "socks.example.com:1080", true, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	options := DefaultTransportOptions()
+	options.MaxConnsPerHost = 10
+	options.IdleConnTimeout = time.Second * 90
+	options.DialTimeout = time.Second * 5
+	options.TLSHandshakeTimeout = time.Second * 10
+	options.ResponseHeaderTimeout = time.Second * 30
+	options.ExpectContinueTimeout = time.Second
+	options.ForceAttemptHTTP2 = true
+	if err := connection.SetTransportOptions(options); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	tr := connection.Client.Transport.(*http.Transport)
+	if tr.MaxConnsPerHost != 10 || tr.IdleConnTimeout != time.Second*90 || tr.TLSHandshakeTimeout != time.Second*10 ||
+		tr.ResponseHeaderTimeout != time.Second*30 || tr.ExpectContinueTimeout != time.Second || !tr.ForceAttemptHTTP2 {
+		t.Errorf("Transport options were not applied, got %+v", tr)
+	}
+	if tr.DialContext == nil {
+		t.Errorf("Expected SOCKS5 dialer to be kept.")
+	}
+	if connection.TransportOptions != options {
+		t.Errorf("Expected TransportOptions to be updated, got %+v instead.", connection.TransportOptions)
+	}
+}
+
+func TestTransportOptions_H2C(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"proto":"` + r.Proto + `"}`))
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	data := make(map[string]interface{})
+	if err := connection.GetJSON("/", &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["proto"] != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/1.1 without H2C, got '%v' instead.", data["proto"])
+	}
+
+	options := DefaultTransportOptions()
+	options.H2C = true
+	if err := connection.SetTransportOptions(options); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	if err := connection.GetJSON("/", &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["proto"] != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2.0 with H2C, got '%v' instead.", data["proto"])
+	}
+}
+
+func TestTransportOptions_H2CWithTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"proto":"` + r.Proto + `"}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	options := DefaultTransportOptions()
+	options.H2C = true
+	if err := connection.SetTransportOptions(options); err != nil {
+		t.Fatalf("Error setting transport options: %v", err.Error())
+	}
+	data := make(map[string]interface{})
+	if err := connection.GetJSON("/", &data); err != nil {
+		t.Fatalf("Error in request: %v", err.Error())
+	}
+	if data["proto"] != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/1.1 via https with H2C, got '%v' instead.", data["proto"])
+	}
+}
+
+func TestTransportOptions_Concurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if _, err := connection.Get("/"); err != nil {
+				t.Errorf("Error in request: %v", err.Error())
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := connection.SetTransportOptions(DefaultTransportOptions()); err != nil {
+			t.Fatalf("Error setting transport options: %v", err.Error())
+		}
+	}
+	<-done
+}
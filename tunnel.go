@@ -0,0 +1,127 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Tunnel asks the server of the connection, acting as a proxy, to open a tunnel
+// to target ("host:port") with a HTTP CONNECT request and returns the connection
+// carrying the tunnel for raw bidirectional traffic. The caller must close it.
+//
+// The server is reached directly or through the SOCKS5 proxy of the connection,
+// a HTTP proxy is not used. With https, the connection to the server is
+// encrypted. SendHeaders are sent with the request and User and Password as
+// Proxy-Authorization. The connection Timeout limits the time until the response
+// to the CONNECT request arrived. Responses other than 2xx are returned as
+// *StatusError.
+//
+// WithHeader and WithoutHeader change the headers of the CONNECT request,
+// WithBasicAuth replaces the Proxy-Authorization and WithTimeout the connection
+// Timeout. WithQuery and WithTemplate do not apply to a target.
+func (connection *Connection) Tunnel(ctx context.Context, target string, options ...RequestOption) (net.Conn, error) {
+	o := newRequestOptions(options)
+	timeout := connection.Timeout
+	if o.timeout > 0 {
+		timeout = o.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer, err := connection.newDialer(connection.transportOptions())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(connection.Server, strconv.Itoa(connection.Port)))
+	if err != nil {
+		return nil, err
+	}
+	if connection.Protocol == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         connection.Server,
+			InsecureSkipVerify: !connection.ValidateSSL,
+			NextProtos:         []string{"http/1.1"},
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// Abort the handshake when ctx is done by expiring the deadline.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	tunnel, err := connection.connect(conn, target, o)
+	if !stop() || err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connect sends the CONNECT request for target over conn and reads the response.
+func (connection *Connection) connect(conn net.Conn, target string, o *requestOptions) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Host: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	for h, v := range connection.SendHeaders {
+		req.Header.Set(h, v)
+	}
+	if o.auth {
+		req.Header.Set("Proxy-Authorization", basicAuth(o.user, o.password))
+	} else if connection.User != "" {
+		req.Header.Set("Proxy-Authorization", basicAuth(connection.User, connection.Password))
+	}
+	o.applyHeader(req.Header)
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	r, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxErrorBody))
+		r.Body.Close()
+		return nil, newStatusError(r, body)
+	}
+	if reader.Buffered() > 0 {
+		// The server already sent data through the tunnel.
+		return &tunnelConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// tunnelConn is a tunnel whose first bytes were already read into reader.
+type tunnelConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	if c.reader.Buffered() > 0 {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
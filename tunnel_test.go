@@ -0,0 +1,109 @@
+package lra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// newTunnelServer returns a proxy which greets with "hello" on every tunnel and
+// echoes everything sent through it afterwards.
+func newTunnelServer(tls bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" || r.Host != "backend:443" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != "Basic YWRtaW46MTIzNA==" || r.Header.Get("Test-Header") != "test" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			w.Write([]byte("authentication required"))
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\nhello")
+		buf.Flush()
+		io.Copy(conn, buf)
+	})
+	if tls {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func newTunnelConnection(t *testing.T, server *httptest.Server, user string) *Connection {
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	connection, err := NewConnection(u.Scheme == "https", u.Hostname(), port, "", user, "1234", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	return connection
+}
+
+func TestTunnel_OK(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		server := newTunnelServer(tls)
+		connection := newTunnelConnection(t, server, "admin")
+		conn, err := connection.Tunnel(context.Background(), "backend:443")
+		if err != nil {
+			t.Fatalf("Error opening tunnel: %v", err.Error())
+		}
+		greeting := make([]byte, 5)
+		if _, err := io.ReadFull(conn, greeting); err != nil || string(greeting) != "hello" {
+			t.Errorf("Expected greeting 'hello', got '%v' and '%v' instead.", string(greeting), err)
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("Error writing to tunnel: %v", err.Error())
+		}
+		echo := make([]byte, 4)
+		if _, err := io.ReadFull(conn, echo); err != nil || string(echo) != "ping" {
+			t.Errorf("Expected echo 'ping', got '%v' and '%v' instead.", string(echo), err)
+		}
+		conn.Close()
+		server.Close()
+	}
+}
+
+func TestTunnel_Rejected(t *testing.T) {
+	server := newTunnelServer(false)
+	defer server.Close()
+
+	connection := newTunnelConnection(t, server, "")
+	conn, err := connection.Tunnel(context.Background(), "backend:443")
+	if conn != nil {
+		t.Errorf("Expected no connection, got '%v' instead.", conn)
+	}
+	var statusError *StatusError
+	if !errors.As(err, &statusError) {
+		t.Fatalf("Expected a StatusError, got '%v' instead.", err)
+	}
+	if statusError.StatusCode != http.StatusProxyAuthRequired || string(statusError.Body) != "authentication required" {
+		t.Errorf("Expected status 407 with body, got %v and '%v' instead.", statusError.StatusCode, string(statusError.Body))
+	}
+}
+
+func TestTunnel_Options(t *testing.T) {
+	server := newTunnelServer(false)
+	defer server.Close()
+
+	connection := newTunnelConnection(t, server, "")
+	conn, err := connection.Tunnel(context.Background(), "backend:443", WithBasicAuth("admin", "1234"))
+	if err != nil {
+		t.Fatalf("Error opening tunnel with WithBasicAuth: %v", err.Error())
+	}
+	conn.Close()
+
+	connection = newTunnelConnection(t, server, "admin")
+	if _, err := connection.Tunnel(context.Background(), "backend:443", WithoutHeader("Test-Header")); err == nil {
+		t.Errorf("Expected the tunnel to be rejected without Test-Header, got nil")
+	}
+}
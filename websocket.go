@@ -0,0 +1,222 @@
+// Copyright 2018-2022 Jörn Ott. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lra
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// MessageType is the type of a WebSocket message.
+type MessageType = websocket.MessageType
+
+const (
+	// MessageText is a UTF-8 encoded text message.
+	MessageText = websocket.MessageText
+	// MessageBinary is a binary message.
+	MessageBinary = websocket.MessageBinary
+)
+
+// WebSocketOptions configures a WebSocket opened by DialWebSocket.
+//
+// Subprotocols are offered to the server in the Sec-WebSocket-Protocol header.
+// If PingInterval is set, a ping is sent in this interval and the WebSocket is
+// closed when no pong arrives within PingTimeout (default: PingInterval). The
+// WebSocket is then read continuously in the background, so pongs also arrive
+// for a client which only writes. Received messages are kept until ReadMessage
+// is called, a pong arriving behind an unread message is not processed before
+// the message is read. ReadLimit is the maximum size of a received message in
+// bytes (default 32 KiB).
+type WebSocketOptions struct {
+	Subprotocols []string
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	ReadLimit    int64
+}
+
+// WebSocket is a message oriented WebSocket connection. Reads and writes may
+// happen concurrently, but only one read and one write at a time.
+type WebSocket struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+
+	// messages receives the messages read in the background if the keepalive
+	// is enabled, readErr is set before it is closed.
+	messages chan webSocketMessage
+	readErr  error
+}
+
+type webSocketMessage struct {
+	typ  MessageType
+	data []byte
+}
+
+// DialWebSocket opens a WebSocket to endpoint. The upgrade handshake is sent with
+// the http client of the connection, so proxy, TLS settings, SendHeaders and the
+// credentials of the connection are used. The connection Timeout limits the
+// handshake, options may be nil. The request options apply to the handshake.
+func (connection *Connection) DialWebSocket(ctx context.Context, endpoint string, options *WebSocketOptions, reqOptions ...RequestOption) (*WebSocket, error) {
+	if options == nil {
+		options = new(WebSocketOptions)
+	}
+	o := newRequestOptions(reqOptions)
+	endpoint, err := o.endpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(connection.BaseURL + endpoint)
+	if err != nil {
+		return nil, err
+	}
+	o.applyQuery(u)
+	header := make(http.Header)
+	for h, v := range connection.SendHeaders {
+		header.Set(h, v)
+	}
+	if o.auth {
+		header.Set("Authorization", basicAuth(o.user, o.password))
+	}
+	o.applyHeader(header)
+	conn, _, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{
+		HTTPClient:   o.client(connection.httpClient()),
+		HTTPHeader:   header,
+		Subprotocols: options.Subprotocols,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if options.ReadLimit > 0 {
+		conn.SetReadLimit(options.ReadLimit)
+	}
+
+	keepaliveCtx, cancel := context.WithCancel(context.Background())
+	ws := &WebSocket{
+		conn:   conn,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if options.PingInterval > 0 {
+		timeout := options.PingTimeout
+		if timeout <= 0 {
+			timeout = options.PingInterval
+		}
+		ws.messages = make(chan webSocketMessage, 1)
+		go ws.read(keepaliveCtx)
+		go ws.keepalive(keepaliveCtx, options.PingInterval, timeout)
+	} else {
+		close(ws.done)
+	}
+	return ws, nil
+}
+
+// Subprotocol returns the subprotocol selected by the server.
+func (ws *WebSocket) Subprotocol() string {
+	return ws.conn.Subprotocol()
+}
+
+// ReadMessage reads the next message.
+func (ws *WebSocket) ReadMessage(ctx context.Context) (MessageType, []byte, error) {
+	if ws.messages == nil {
+		return ws.conn.Read(ctx)
+	}
+	select {
+	case m, ok := <-ws.messages:
+		if !ok {
+			return 0, nil, ws.readErr
+		}
+		return m.typ, m.data, nil
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+// WriteMessage sends data as a single message of the given type.
+func (ws *WebSocket) WriteMessage(ctx context.Context, messageType MessageType, data []byte) error {
+	return ws.conn.Write(ctx, messageType, data)
+}
+
+// ReadJSON reads the next message and parses it as JSON into v.
+func (ws *WebSocket) ReadJSON(ctx context.Context, v interface{}) error {
+	_, data, err := ws.ReadMessage(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (ws *WebSocket) WriteJSON(ctx context.Context, v interface{}) error {
+	return wsjson.Write(ctx, ws.conn, v)
+}
+
+// Ping sends a ping and waits for the pong. Without PingInterval, a read must be
+// in progress concurrently for the pong to be received.
+func (ws *WebSocket) Ping(ctx context.Context) error {
+	return ws.conn.Ping(ctx)
+}
+
+// Close stops the keepalive and closes the WebSocket with a normal closure.
+func (ws *WebSocket) Close() error {
+	var err error
+	ws.once.Do(func() {
+		ws.cancel()
+		<-ws.done
+		err = ws.conn.Close(websocket.StatusNormalClosure, "")
+	})
+	return err
+}
+
+// read reads messages in the background until the WebSocket fails or is closed.
+func (ws *WebSocket) read(ctx context.Context) {
+	defer close(ws.messages)
+	for {
+		// The read is not bound to ctx, cancelling a read closes the WebSocket
+		// before Close could send a normal closure.
+		typ, data, err := ws.conn.Read(context.Background())
+		if err != nil {
+			ws.readErr = err
+			return
+		}
+		select {
+		case ws.messages <- webSocketMessage{typ: typ, data: data}:
+		case <-ctx.Done():
+			ws.readErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (ws *WebSocket) keepalive(ctx context.Context, interval time.Duration, timeout time.Duration) {
+	defer close(ws.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := ws.conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				// The peer is gone, fail pending reads and writes.
+				ws.conn.CloseNow()
+			}
+			return
+		}
+	}
+}
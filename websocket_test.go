@@ -0,0 +1,166 @@
+package lra
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func newWebSocketServer(t *testing.T, tls bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if r.Header.Get("Test-Header") != "test" || user != "admin" || password != "1234" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/ws" && r.URL.Path != "/sink" || r.URL.Query().Get("reject") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: []string{"echo"}})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		if r.URL.Path == "/sink" {
+			for {
+				if _, _, err := conn.Read(r.Context()); err != nil {
+					return
+				}
+			}
+		}
+		for {
+			typ, data, err := conn.Read(r.Context())
+			if err != nil {
+				return
+			}
+			if err := conn.Write(r.Context(), typ, data); err != nil {
+				return
+			}
+		}
+	})
+	if tls {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func newWebSocketConnection(t *testing.T, server *httptest.Server) *Connection {
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	connection, err := NewConnection(u.Scheme == "https", u.Hostname(), port, "", "admin", "1234", false, "", false, HL, Timeout)
+	if err != nil {
+		t.Fatalf("Error creating connection: %v", err.Error())
+	}
+	return connection
+}
+
+func TestDialWebSocket_OK(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		server := newWebSocketServer(t, tls)
+		connection := newWebSocketConnection(t, server)
+		ctx := context.Background()
+		ws, err := connection.DialWebSocket(ctx, "/ws", &WebSocketOptions{
+			Subprotocols: []string{"echo"},
+			PingInterval: time.Millisecond * 20,
+		})
+		if err != nil {
+			t.Fatalf("Error dialing WebSocket: %v", err.Error())
+		}
+		if ws.Subprotocol() != "echo" {
+			t.Errorf("Expected subprotocol 'echo', got '%v' instead.", ws.Subprotocol())
+		}
+
+		if err := ws.WriteJSON(ctx, ReturnData{StringData: "hello", IntData: 42}); err != nil {
+			t.Fatalf("Error writing JSON: %v", err.Error())
+		}
+		var data ReturnData
+		if err := ws.ReadJSON(ctx, &data); err != nil {
+			t.Fatalf("Error reading JSON: %v", err.Error())
+		}
+		if data.StringData != "hello" || data.IntData != 42 {
+			t.Errorf("Expected echoed JSON, got %+v instead.", data)
+		}
+
+		// The keepalive pings several times without a pending read.
+		time.Sleep(time.Millisecond * 60)
+		if err := ws.WriteMessage(ctx, MessageBinary, []byte{1, 2, 3}); err != nil {
+			t.Fatalf("Error writing message: %v", err.Error())
+		}
+		typ, b, err := ws.ReadMessage(ctx)
+		if err != nil || typ != MessageBinary || len(b) != 3 {
+			t.Errorf("Expected binary echo, got %v, %v and '%v' instead.", typ, b, err)
+		}
+		if err := ws.Close(); err != nil {
+			t.Errorf("Error closing WebSocket: %v", err.Error())
+		}
+		server.Close()
+	}
+}
+
+func TestDialWebSocket_WriteOnly(t *testing.T) {
+	server := newWebSocketServer(t, false)
+	defer server.Close()
+
+	connection := newWebSocketConnection(t, server)
+	ctx := context.Background()
+	ws, err := connection.DialWebSocket(ctx, "/sink", &WebSocketOptions{
+		PingInterval: time.Millisecond * 20,
+		PingTimeout:  time.Millisecond * 100,
+	})
+	if err != nil {
+		t.Fatalf("Error dialing WebSocket: %v", err.Error())
+	}
+	for i := 0; i < 15; i++ {
+		if err := ws.WriteMessage(ctx, MessageText, []byte("data")); err != nil {
+			t.Fatalf("Error writing message %v: %v", i, err.Error())
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	if err := ws.Close(); err != nil {
+		t.Errorf("Error closing WebSocket: %v", err.Error())
+	}
+}
+
+func TestDialWebSocket_Unauthorized(t *testing.T) {
+	server := newWebSocketServer(t, false)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	if _, err := connection.DialWebSocket(context.Background(), "/ws", nil); err == nil {
+		t.Errorf("Expected handshake error without credentials, got nil")
+	}
+}
+
+func TestDialWebSocket_RequestOptions(t *testing.T) {
+	server := newWebSocketServer(t, false)
+	defer server.Close()
+
+	connection := newTestConnection(t, server)
+	ctx := context.Background()
+	ws, err := connection.DialWebSocket(ctx, "/{path}", nil,
+		WithTemplate(map[string]interface{}{"path": "ws"}),
+		WithQuery("client", "test"),
+		WithBasicAuth("admin", "1234"))
+	if err != nil {
+		t.Fatalf("Error dialing WebSocket with options: %v", err.Error())
+	}
+	ws.Close()
+
+	connection = newWebSocketConnection(t, server)
+	if _, err := connection.DialWebSocket(ctx, "/ws", nil, WithQuery("reject", "1")); err == nil {
+		t.Errorf("Expected the query to be sent, got nil")
+	}
+	if _, err := connection.DialWebSocket(ctx, "/ws", nil, WithoutHeader("Test-Header")); err == nil {
+		t.Errorf("Expected the header to be removed, got nil")
+	}
+	if _, err := connection.DialWebSocket(ctx, "/ws", nil, WithBasicAuth("admin", "wrong")); err == nil {
+		t.Errorf("Expected the credentials to be replaced, got nil")
+	}
+}